@@ -0,0 +1,55 @@
+package fsm
+
+import "fmt"
+
+// OnEnterAsync registers a callback run in its own goroutine once the
+// subject has entered the state, for fire-and-forget effects such as
+// sending an email. It is started only when the outermost call on the
+// Machine has completed, including any automatic transitions following
+// it, so it never runs for a step TransitionPathAtomic moves back. It can
+// neither fail nor delay the transition, and runs without the Machine
+// locked. A panic in fn is recovered and reported to the handler set with
+// SetAsyncErrorHandler.
+func (m *Machine) OnEnterAsync(s State, fn func(subject Stater)) {
+	defer m.lock()()
+
+	if m.async == nil {
+		m.async = make(map[State][]func(subject Stater))
+	}
+	m.async[s] = append(m.async[s], fn)
+}
+
+// SetAsyncErrorHandler sets the function panics recovered from
+// OnEnterAsync callbacks are reported to, wrapping ErrCallbackPanic.
+// By default they are discarded.
+func (m *Machine) SetAsyncErrorHandler(fn func(err error)) {
+	defer m.lock()()
+
+	m.asyncErr = fn
+}
+
+// flush runs the effects deferred by the operation in progress, once it
+// has completed; m.mu must be held.
+func (m *Machine) flush() {
+	effects := m.effects
+	m.effects = nil
+	for _, fn := range effects {
+		fn()
+	}
+}
+
+// enterAsync starts the OnEnterAsync callbacks for the state entered;
+// m.mu must be held.
+func (m *Machine) enterAsync(subject Stater, s State) {
+	report := m.asyncErr
+	for _, fn := range m.async[s] {
+		go func(fn func(subject Stater)) {
+			defer func() {
+				if v := recover(); v != nil && report != nil {
+					report(fmt.Errorf("%w: entering %s: %v", ErrCallbackPanic, s, v))
+				}
+			}()
+			fn(subject)
+		}(fn)
+	}
+}
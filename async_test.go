@@ -0,0 +1,42 @@
+package fsm
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnEnterAsyncSkipsRolledBackPath(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2})
+	r.AddRuleE(T{1, 2}, func(Stater, State) error { return errors.New("closed") })
+	s := NewSafeState(0)
+	m := New(&r, s)
+
+	var started atomic.Int32
+	done := make(chan struct{}, 1)
+	m.OnEnterAsync(1, func(Stater) {
+		started.Add(1)
+		done <- struct{}{}
+	})
+
+	if err := m.TransitionPathAtomic(1, 2); err == nil {
+		t.Fatal("expected the path to fail")
+	}
+	if s.CurrentState() != 0 {
+		t.Fatalf("state = %v, want 0", s.CurrentState())
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := started.Load(); n != 0 {
+		t.Fatalf("OnEnterAsync ran %d times for a rolled back path", n)
+	}
+
+	if err := m.Transition(1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnEnterAsync didn't run after a committed transition")
+	}
+}
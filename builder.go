@@ -0,0 +1,72 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Builder constructs a RuleSet fluently:
+//
+//	rules, err := fsm.NewBuilder().
+//		From(Pending).To(Approved).When(isManager).
+//		From(Pending).To(Rejected).
+//		Build()
+//
+// To adds a transition from the last From state; When adds guards to the
+// last transition. Mistakes are collected and reported by Build.
+type Builder struct {
+	rules  RuleSet
+	origin *State
+	edge   *T
+	seen   map[T]bool
+	errs   []error
+}
+
+// NewBuilder returns an empty Builder
+func NewBuilder() *Builder {
+	return &Builder{seen: make(map[T]bool)}
+}
+
+// From sets the origin of the following transitions
+func (b *Builder) From(s State) *Builder {
+	b.origin = &s
+	b.edge = nil
+	return b
+}
+
+// To adds a transition from the current origin to goal
+func (b *Builder) To(goal State) *Builder {
+	if b.origin == nil {
+		b.errs = append(b.errs, fmt.Errorf("transition to %s has no origin", goal))
+		return b
+	}
+
+	t := T{*b.origin, goal}
+	if b.seen[t] {
+		b.errs = append(b.errs, fmt.Errorf("duplicate transition from %s to %s", t.O, t.E))
+	} else {
+		b.seen[t] = true
+		b.rules.AddTransition(t)
+	}
+	b.edge = &t
+	return b
+}
+
+// When adds Guards to the last transition
+func (b *Builder) When(guards ...Guard) *Builder {
+	if b.edge == nil {
+		b.errs = append(b.errs, errors.New("guards added before any transition"))
+		return b
+	}
+
+	b.rules.AddRule(*b.edge, guards...)
+	return b
+}
+
+// Build returns the finished RuleSet, or the mistakes found while building
+func (b *Builder) Build() (RuleSet, error) {
+	if len(b.errs) > 0 {
+		return RuleSet{}, errors.Join(b.errs...)
+	}
+	return b.rules, nil
+}
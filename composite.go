@@ -0,0 +1,85 @@
+package fsm
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNoSuchRegion the composite machine has no region of that name
+var ErrNoSuchRegion = errors.New("no such region")
+
+// CompositeMachine holds independent Machines as named orthogonal
+// regions of one subject. Each region keeps its own rules, subject and
+// lock, so transitions in one region never affect another.
+// The zero value is an empty CompositeMachine ready to use.
+type CompositeMachine struct {
+	mu      sync.RWMutex
+	regions map[string]*Machine
+}
+
+// AddRegion adds m as the named region, replacing any region of the
+// same name.
+func (c *CompositeMachine) AddRegion(name string, m *Machine) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.regions == nil {
+		c.regions = make(map[string]*Machine)
+	}
+	c.regions[name] = m
+}
+
+// Region returns the Machine of the named region, or nil
+func (c *CompositeMachine) Region(name string) *Machine {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.regions[name]
+}
+
+// Regions returns the sorted names of the regions
+func (c *CompositeMachine) Regions() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.regions))
+	for name := range c.regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fire fires the named event in the region; see Machine.Fire
+func (c *CompositeMachine) Fire(region, event string) error {
+	m := c.Region(region)
+	if m == nil {
+		return ErrNoSuchRegion
+	}
+	return m.Fire(event)
+}
+
+// Transition moves the region's subject to the goal state; see
+// Machine.Transition
+func (c *CompositeMachine) Transition(region string, goal State) error {
+	m := c.Region(region)
+	if m == nil {
+		return ErrNoSuchRegion
+	}
+	return m.Transition(goal)
+}
+
+// States returns the current state of every region by name
+func (c *CompositeMachine) States() map[string]State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	states := make(map[string]State, len(c.regions))
+	for name, m := range c.regions {
+		unlock := m.lock()
+		states[name] = m.Subject.CurrentState()
+		unlock()
+	}
+	return states
+}
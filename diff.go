@@ -0,0 +1,91 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Equal reports whether other has the same transitions, with the same
+// number of guards each, the same terminal states and the same start
+// state. Guards themselves can't be compared.
+func (r *RuleSet) Equal(other RuleSet) bool {
+	return r.Diff(other) == ""
+}
+
+// Diff describes how other differs from the rule set, one change per
+// line: "+" for transitions and terminal states only other has, "-" for
+// those only the rule set has, and "~" for transitions with a different
+// number of guards and for a different start state. Lines are ordered by
+// transition, then terminal state, then start state. The diff is empty
+// when the rule sets are Equal.
+func (r *RuleSet) Diff(other RuleSet) string {
+	var b strings.Builder
+
+	edges := make(map[T]bool)
+	for _, rules := range []*RuleSet{r, &other} {
+		for t := range rules.rules {
+			edges[T{t.Origin(), t.Exit()}] = true
+		}
+	}
+	for _, t := range sortedTransitions(edges) {
+		mine, inMine := r.rules[t]
+		theirs, inTheirs := other.rules[t]
+		switch {
+		case !inMine:
+			fmt.Fprintf(&b, "+ %s -> %s\n", t.O, t.E)
+		case !inTheirs:
+			fmt.Fprintf(&b, "- %s -> %s\n", t.O, t.E)
+		case len(mine) != len(theirs):
+			fmt.Fprintf(&b, "~ %s -> %s: %d guards, was %d\n", t.O, t.E, len(theirs), len(mine))
+		}
+	}
+
+	states := make(map[State]bool)
+	for s := range r.terminals {
+		states[s] = true
+	}
+	for s := range other.terminals {
+		states[s] = true
+	}
+	terminals := make([]State, 0, len(states))
+	for s := range states {
+		terminals = append(terminals, s)
+	}
+	sort.Slice(terminals, func(i, j int) bool { return terminals[i] < terminals[j] })
+	for _, s := range terminals {
+		switch {
+		case !r.terminals[s]:
+			fmt.Fprintf(&b, "+ terminal %s\n", s)
+		case !other.terminals[s]:
+			fmt.Fprintf(&b, "- terminal %s\n", s)
+		}
+	}
+
+	if r.hasStart != other.hasStart || r.start != other.start {
+		fmt.Fprintf(&b, "~ start %s, was %s\n", startName(&other), startName(r))
+	}
+
+	return b.String()
+}
+
+func sortedTransitions(set map[T]bool) []T {
+	ts := make([]T, 0, len(set))
+	for t := range set {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].O != ts[j].O {
+			return ts[i].O < ts[j].O
+		}
+		return ts[i].E < ts[j].E
+	})
+	return ts
+}
+
+func startName(r *RuleSet) string {
+	if !r.hasStart {
+		return "unset"
+	}
+	return r.start.String()
+}
@@ -0,0 +1,30 @@
+package fsm
+
+// DisableTransition blocks the transition between two exact states on
+// this Machine, whatever the rules say, until EnableTransition is called.
+// Attempts fail with ErrTransitionDisabled before any guard runs, and
+// CanTransition and AvailableTransitions report the edge as not
+// permitted. The RuleSet is not changed.
+func (m *Machine) DisableTransition(from, to State) {
+	defer m.lock()()
+
+	if m.disabled == nil {
+		m.disabled = make(map[T]bool)
+	}
+	m.disabled[T{from, to}] = true
+}
+
+// EnableTransition lifts a block set with DisableTransition
+func (m *Machine) EnableTransition(from, to State) {
+	defer m.lock()()
+
+	delete(m.disabled, T{from, to})
+}
+
+// DisabledTransitions returns the blocked transitions sorted by origin
+// then exit
+func (m *Machine) DisabledTransitions() []T {
+	defer m.lock()()
+
+	return sortedTransitions(m.disabled)
+}
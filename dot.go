@@ -0,0 +1,50 @@
+package fsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ToDOT writes the transition graph as a Graphviz digraph, with one node
+// per state and one edge per transition labeled with its event names.
+func (r *RuleSet) ToDOT(w io.Writer) error {
+	labels := make(map[T][]string)
+	for _, e := range r.events {
+		t := T{e.From, e.To}
+		labels[t] = append(labels[t], e.Name)
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph fsm {")
+
+	for _, s := range r.States() {
+		fmt.Fprintf(b, "\t%s;\n", dotID(s.String()))
+	}
+
+	seen := make(map[T]bool)
+	for _, t := range r.Transitions() {
+		edge := T{t.Origin(), t.Exit()}
+		if seen[edge] {
+			continue
+		}
+		seen[edge] = true
+
+		fmt.Fprintf(b, "\t%s -> %s", dotID(edge.O.String()), dotID(edge.E.String()))
+		if names := labels[edge]; len(names) > 0 {
+			sort.Strings(names)
+			fmt.Fprintf(b, " [label=%s]", dotID(strings.Join(names, ", ")))
+		}
+		fmt.Fprintln(b, ";")
+	}
+
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// dotID quotes s as a DOT identifier
+func dotID(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,49 @@
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// GuardResult is the outcome of a single guard in a DryRun
+type GuardResult struct {
+	Rule   Transition // Rule the guard belongs to
+	Index  int        // Index of the guard within the rule; global guards follow the rule's own
+	Name   string     // Name of the guard; see AddNamedRule
+	Passed bool
+	Err    error // Err is why the guard failed
+}
+
+// DryRun runs every guard of every rule matching the attempted
+// transition, without short-circuiting, and reports each outcome.
+// Nothing is reported when no rule matches or the subject is in a
+// terminal state.
+func (r *RuleSet) DryRun(subject Stater, goal State) []GuardResult {
+	a := newAttempt(subject, goal)
+	if r.terminals[a.origin] {
+		return nil
+	}
+
+	var results []GuardResult
+	for _, t := range r.candidates(a.origin, a.goal) {
+		guards := append(r.rules[t][:len(r.rules[t]):len(r.rules[t])], r.global...)
+
+		try := *a
+		try.rule = t
+
+		outcomes := make([]GuardResult, len(guards))
+		var wg sync.WaitGroup
+		for i, g := range guards {
+			wg.Add(1)
+			go func(i int, g guard) {
+				defer wg.Done()
+				err := g.call(context.Background(), &try)
+				outcomes[i] = GuardResult{Rule: t, Index: i, Name: g.name, Passed: err == nil, Err: err}
+			}(i, g)
+		}
+		wg.Wait()
+
+		results = append(results, outcomes...)
+	}
+	return results
+}
@@ -1,20 +1,239 @@
 package fsm
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
 
 // State is the type of fsm state
 type State int
 
+// AnyState used as the origin of a Transition matches whatever the
+// subject's current state is. Rules with a concrete origin are tried
+// before wildcard rules of the same priority.
+const AnyState State = -1
+
 // Guard provides protection against transitioning to the goal State.
 // Returning true/false indicates if the transition is permitted or not.
 type Guard func(subject Stater, goal State) bool
 
+// GuardE is like Guard but reports why a transition is not permitted.
+// Returning nil indicates the transition is permitted.
+type GuardE func(subject Stater, goal State) error
+
+// ContextGuard is like GuardE but receives the context of the transition
+// attempt, allowing guards performing I/O to be cancelled.
+type ContextGuard func(ctx context.Context, subject Stater, goal State) error
+
+// ArgsGuard is like Guard but also receives the arguments passed to
+// Machine.TransitionWith; args is nil for any other transition.
+type ArgsGuard func(subject Stater, goal State, args any) bool
+
+// TransitionGuard is like Guard but receives the Transition of the rule
+// it was added to, so one guard can serve many edges. For rules from
+// AnyState or a parent state that is the rule's Transition, not the
+// subject's actual origin.
+type TransitionGuard func(subject Stater, t Transition) bool
+
+// GuardProvider is a stateful guard, such as one reading configuration
+// that is reloaded at runtime. Its Guard method is called on every
+// evaluation, possibly concurrently, so it must be safe for concurrent
+// use.
+type GuardProvider interface {
+	Guard(subject Stater, goal State) bool
+}
+
+// Condition is a guard defined as a type, such as a struct holding its
+// dependencies. Check reports whether the transition is permitted and, if
+// not, why.
+type Condition interface {
+	Check(subject Stater, goal State) (ok bool, reason string)
+}
+
+// attempt carries a single transition attempt to guards and callbacks
+type attempt struct {
+	subject      Stater
+	origin, goal State
+	args         any
+
+	// rule is the transition whose rule matched the attempt
+	rule Transition
+
+	// result is the value produced by an OnEnterResult callback
+	result any
+
+	// reason is the reason given to TransitionReason
+	reason string
+
+	// immutable replaces an ImmutableStater subject instead of calling
+	// SetState; original is the subject it replaced.
+	immutable bool
+	original  Stater
+}
+
+// guard is the form every kind of guard is stored in
+type guard struct {
+	check func(ctx context.Context, a *attempt) error
+
+	// fn is the guard function as it was registered; nil for the
+	// default rule of AddTransition.
+	fn any
+
+	// name identifies the guard in diagnostics
+	name string
+
+	// exported marks a guard named by AddNamedRule or a loaded
+	// definition, whose name is encoded with the rule set.
+	exported bool
+
+	// unattached marks the stand-in for a guard named by a loaded
+	// definition, rejecting until AttachGuards replaces it.
+	unattached bool
+}
+
+// defaultGuardName names the guard added by AddTransition
+const defaultGuardName = "origin"
+
+// named returns g with the given name, or with the name of the
+// registered function when name is empty.
+func (g guard) named(name string) guard {
+	if name == "" && g.fn != nil {
+		if f := runtime.FuncForPC(reflect.ValueOf(g.fn).Pointer()); f != nil {
+			name = f.Name()
+		}
+	}
+	g.name = name
+	return g
+}
+
+// call runs the guard, turning a panic into an error wrapping
+// ErrGuardPanic so one faulty guard can't crash the caller.
+func (g guard) call(ctx context.Context, a *attempt) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if cause, ok := v.(error); ok {
+				err = fmt.Errorf("%w: %w", ErrGuardPanic, cause)
+			} else {
+				err = fmt.Errorf("%w: %v", ErrGuardPanic, v)
+			}
+		}
+	}()
+	return g.check(ctx, a)
+}
+
 var (
 	// ErrInvalidTransition the state transition is not allowed
 	ErrInvalidTransition = errors.New("invalid transition")
+
+	// ErrNoSuchEvent the event is not defined for the current state
+	ErrNoSuchEvent = errors.New("no such event")
+
+	// ErrGuardTimeout a guard did not return within the allowed time
+	ErrGuardTimeout = errors.New("guard timed out")
+
+	// ErrTerminalState the subject is in a terminal state
+	ErrTerminalState = errors.New("terminal state")
+
+	// ErrCooldown the transition was used too recently
+	ErrCooldown = errors.New("transition cooling down")
+
+	// ErrUnknownState the goal is not the exit of any rule
+	ErrUnknownState = errors.New("unknown state")
+
+	// ErrTransitionDisabled the transition was disabled on the Machine
+	ErrTransitionDisabled = errors.New("transition disabled")
+
+	// ErrNotImmutable the subject is not an ImmutableStater
+	ErrNotImmutable = errors.New("subject is not immutable")
+
+	// ErrReentrantTransition a callback of a transition tried to start
+	// another transition on the same Machine
+	ErrReentrantTransition = errors.New("reentrant transition")
+
+	// ErrStalePrepare the prepared transition can no longer be committed
+	ErrStalePrepare = errors.New("prepared transition is stale")
+
+	// ErrFrozen the rule set was frozen and can't be changed
+	ErrFrozen = errors.New("rule set is frozen")
+
+	// ErrCallbackPanic an asynchronous callback panicked
+	ErrCallbackPanic = errors.New("callback panicked")
+
+	// ErrGuardNotAttached a guard named by a loaded definition was not
+	// attached with AttachGuards
+	ErrGuardNotAttached = errors.New("guard not attached")
+
+	// ErrGuardPanic a guard panicked; the transition is not permitted
+	ErrGuardPanic = errors.New("guard panicked")
+
+	// ErrAutoTransitionLimit automatic transitions did not settle in a state
+	ErrAutoTransitionLimit = errors.New("auto transition limit exceeded")
 )
 
-// Transition is the change between States
+// InvalidTransitionError names the transition that was not allowed.
+// It wraps ErrInvalidTransition.
+type InvalidTransitionError struct {
+	From, To State
+
+	// Guard is the name of the guard that blocked the transition; it is
+	// empty when no rule exists for the transition.
+	Guard string
+
+	// Reason is why the guard blocked the transition, as given by a
+	// Condition; it is often empty.
+	Reason string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	msg := ErrInvalidTransition.Error() + " from " + e.From.String() + " to " + e.To.String()
+	if e.Guard != "" {
+		msg += ": blocked by guard '" + e.Guard + "'"
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Unwrap returns ErrInvalidTransition
+func (e *InvalidTransitionError) Unwrap() error { return ErrInvalidTransition }
+
+// Stater can be passed into the FSM. The Stater is responsible for setting
+// its own default state. Behavior of a Stater without a State is undefined.
+type Stater interface {
+	CurrentState() State
+	SetState(State)
+}
+
+// ImmutableStater is a Stater that is never changed in place: WithState
+// returns a copy in the given state. See Machine.TransitionImmutable.
+type ImmutableStater interface {
+	Stater
+	WithState(s State) Stater
+}
+
+// TimedStater is a Stater that also keeps when it entered its current
+// state. A Machine records the time after every successful transition
+// and reset of a TimedStater subject.
+type TimedStater interface {
+	Stater
+	StateEnteredAt() time.Time
+	SetStateEnteredAt(t time.Time)
+}
+
+// Transition is the change between States.
+// Transitions are used as RuleSet map keys, so implementations must be
+// comparable; a non-comparable implementation, such as a struct holding a
+// slice, panics when added. Keys of different types never match even with
+// the same Origin and Exit, and rules are looked up by T, so rules added
+// for any other implementation are never consulted. Use TransitionEqual
+// to compare transitions by value.
 type Transition interface {
 	Origin() State
 	Exit() State
@@ -32,21 +251,431 @@ func (t T) Origin() State { return t.O }
 // Exit return the transition event
 func (t T) Exit() State { return t.E }
 
+// TransitionEqual reports whether a and b have the same Origin and Exit,
+// whatever their types.
+func TransitionEqual(a, b Transition) bool {
+	return a.Origin() == b.Origin() && a.Exit() == b.Exit()
+}
+
+// Event is a named trigger for the transition between two states
+type Event struct {
+	Name     string
+	From, To State
+}
+
+type eventKey struct {
+	from State
+	name string
+}
+
 // RuleSet stores the rules for the state machine.
-type RuleSet map[Transition][]Guard
+type RuleSet struct {
+	rules   map[Transition][]guard
+	global  []guard
+	events  map[eventKey]Event
+	parents map[State]State
+
+	terminals  map[State]bool
+	priorities map[Transition]int
+
+	start    State
+	hasStart bool
+	tracer   Tracer
+	frozen   bool
+	entered  map[State][]func(subject Stater)
+	groups   map[string][]State
+
+	concurrency int
+}
 
 // AddRule adds Guards for the given Transition
-func (r RuleSet) AddRule(t Transition, guards ...Guard) {
-	for _, guard := range guards {
-		r[t] = append(r[t], guard)
+func (r *RuleSet) AddRule(t Transition, guards ...Guard) {
+	for _, g := range guards {
+		r.addGuard(t, g.guard())
+	}
+}
+
+// AddRulePriority adds Guards for the given Transition and sets its
+// priority. When several rules match an attempted transition, through
+// AnyState or SetParent, they are tried from the highest priority down
+// and the first whose guards all pass permits it. The default is 0.
+func (r *RuleSet) AddRulePriority(t Transition, priority int, guards ...Guard) {
+	r.mutable()
+	if r.priorities == nil {
+		r.priorities = make(map[Transition]int)
+	}
+	r.priorities[t] = priority
+	r.AddRule(t, guards...)
+}
+
+// AddRuleE adds error-returning Guards for the given Transition
+func (r *RuleSet) AddRuleE(t Transition, guards ...GuardE) {
+	for _, g := range guards {
+		r.addGuard(t, g.guard())
+	}
+}
+
+// AddRuleContext adds context-aware Guards for the given Transition
+func (r *RuleSet) AddRuleContext(t Transition, guards ...ContextGuard) {
+	for _, g := range guards {
+		r.addGuard(t, g.guard())
+	}
+}
+
+// AddRuleArgs adds Guards receiving the transition arguments for the
+// given Transition
+func (r *RuleSet) AddRuleArgs(t Transition, guards ...ArgsGuard) {
+	for _, g := range guards {
+		r.addGuard(t, g.guard())
+	}
+}
+
+// AddRuleTransition adds Guards receiving the matched Transition for the
+// given Transition
+func (r *RuleSet) AddRuleTransition(t Transition, guards ...TransitionGuard) {
+	for _, g := range guards {
+		r.addGuard(t, g.guard())
+	}
+}
+
+// AddRuleProvider adds GuardProviders for the given Transition. Each is
+// named by its type in diagnostics.
+func (r *RuleSet) AddRuleProvider(t Transition, providers ...GuardProvider) {
+	for _, p := range providers {
+		r.addGuard(t, providerGuard(p))
+	}
+}
+
+// AddConditions adds Conditions for the given Transition. Each is named
+// by its type, and the reason it gives for blocking the transition is
+// reported in the *InvalidTransitionError.
+func (r *RuleSet) AddConditions(t Transition, conds ...Condition) {
+	for _, c := range conds {
+		r.addGuard(t, conditionGuard(c))
+	}
+}
+
+// AddNamedRule adds a Guard for the given Transition under a name which
+// is reported when it blocks the transition and in diagnostics.
+// Guards added without a name are known by their function's name.
+func (r *RuleSet) AddNamedRule(t Transition, name string, g Guard) {
+	named := g.guard().named(name)
+	named.exported = name != ""
+	r.addGuard(t, named)
+}
+
+func (r *RuleSet) addGuard(t Transition, g guard) {
+	r.mutable()
+	if g.name == "" {
+		g = g.named("")
+	}
+	if r.rules == nil {
+		r.rules = make(map[Transition][]guard)
+	}
+	r.rules[t] = append(r.rules[t], g)
+}
+
+// guard adapts a boolean Guard, failing with ErrInvalidTransition
+func (g Guard) guard() guard {
+	return guard{fn: g, check: func(_ context.Context, a *attempt) error {
+		if !g(a.subject, a.goal) {
+			return ErrInvalidTransition
+		}
+		return nil
+	}}
+}
+
+func (g GuardE) guard() guard {
+	return guard{fn: g, check: func(_ context.Context, a *attempt) error {
+		return g(a.subject, a.goal)
+	}}
+}
+
+func (g ContextGuard) guard() guard {
+	return guard{fn: g, check: func(ctx context.Context, a *attempt) error {
+		return g(ctx, a.subject, a.goal)
+	}}
+}
+
+// guard adapts an ArgsGuard, failing with ErrInvalidTransition
+func (g ArgsGuard) guard() guard {
+	return guard{fn: g, check: func(_ context.Context, a *attempt) error {
+		if !g(a.subject, a.goal, a.args) {
+			return ErrInvalidTransition
+		}
+		return nil
+	}}
+}
+
+func (g TransitionGuard) guard() guard {
+	return guard{fn: g, check: func(_ context.Context, a *attempt) error {
+		if !g(a.subject, a.rule) {
+			return ErrInvalidTransition
+		}
+		return nil
+	}}
+}
+
+// Guards returns the guards of the rule for the given Transition, in
+// registration order, or nil when there is no such rule. Guards of every
+// kind are returned as a Guard; global guards are not included.
+func (r *RuleSet) Guards(t Transition) []Guard {
+	var guards []Guard
+	for _, g := range r.rules[t] {
+		g := g
+		guards = append(guards, func(subject Stater, goal State) bool {
+			a := &attempt{subject: subject, origin: subject.CurrentState(), goal: goal, rule: t}
+			return g.call(context.Background(), a) == nil
+		})
+	}
+	return guards
+}
+
+// GuardNames returns the names of the guards returned by Guards; the
+// default rule of AddTransition is named "origin".
+func (r *RuleSet) GuardNames(t Transition) []string {
+	var names []string
+	for _, g := range r.rules[t] {
+		names = append(names, g.name)
+	}
+	return names
+}
+
+func providerGuard(p GuardProvider) guard {
+	return guard{name: fmt.Sprintf("%T", p), check: func(_ context.Context, a *attempt) error {
+		if !p.Guard(a.subject, a.goal) {
+			return ErrInvalidTransition
+		}
+		return nil
+	}}
+}
+
+func conditionGuard(c Condition) guard {
+	name := fmt.Sprintf("%T", c)
+	return guard{name: name, check: func(_ context.Context, a *attempt) error {
+		if ok, reason := c.Check(a.subject, a.goal); !ok {
+			return &InvalidTransitionError{From: a.origin, To: a.goal, Guard: name, Reason: reason}
+		}
+		return nil
+	}}
+}
+
+// AddGlobalGuard adds Guards which must pass for every transition, in
+// addition to the guards of the transition's own rule.
+func (r *RuleSet) AddGlobalGuard(guards ...Guard) {
+	r.mutable()
+	for _, g := range guards {
+		r.global = append(r.global, g.guard().named(""))
 	}
 }
 
 // AddTransition adds a transition with a default rule
-func (r RuleSet) AddTransition(t Transition) {
-	r.AddRule(t, func(subject Stater, goal State) bool {
-		return subject.CurrentState() == t.Origin()
+func (r *RuleSet) AddTransition(t Transition) {
+	r.addGuard(t, guard{name: defaultGuardName, check: func(_ context.Context, a *attempt) error {
+		if a.rule == nil || a.rule.Origin() != t.Origin() {
+			return ErrInvalidTransition
+		}
+		return nil
+	}})
+}
+
+// RemoveTransition deletes the rule for the transition along with any
+// events moving along it. Removing an unknown transition is a no-op.
+func (r *RuleSet) RemoveTransition(t Transition) {
+	r.mutable()
+	delete(r.rules, t)
+	delete(r.priorities, t)
+	for k, e := range r.events {
+		if e.From == t.Origin() && e.To == t.Exit() {
+			delete(r.events, k)
+		}
+	}
+}
+
+// RemoveRule drops the guard from the rule for the transition, comparing
+// by function pointer. Every closure created by the same function literal
+// shares a pointer and is dropped. Removing an unknown guard is a no-op.
+// Once no guard is left the rule is removed along with its priority, so
+// the transition is no longer permitted.
+func (r *RuleSet) RemoveRule(t Transition, g Guard) {
+	r.mutable()
+	guards, ok := r.rules[t]
+	if !ok {
+		return
+	}
+
+	target := reflect.ValueOf(g).Pointer()
+	kept := guards[:0:0]
+	for _, candidate := range guards {
+		if candidate.fn == nil || reflect.ValueOf(candidate.fn).Pointer() != target {
+			kept = append(kept, candidate)
+		}
+	}
+	if len(kept) == 0 {
+		delete(r.rules, t)
+		delete(r.priorities, t)
+		return
+	}
+	r.rules[t] = kept
+}
+
+// AddEvent defines a named event moving the subject from one state to
+// another, adding the transition along with the given Guards.
+func (r *RuleSet) AddEvent(name string, from State, to State, guards ...Guard) {
+	r.addEvent(Event{Name: name, From: from, To: to})
+
+	t := T{from, to}
+	r.AddTransition(t)
+	r.AddRule(t, guards...)
+}
+
+func (r *RuleSet) addEvent(e Event) {
+	r.mutable()
+	if r.events == nil {
+		r.events = make(map[eventKey]Event)
+	}
+	r.events[eventKey{e.From, e.Name}] = e
+}
+
+// MarkTerminal marks states as final: no transition out of them is ever
+// permitted, regardless of the rules.
+func (r *RuleSet) MarkTerminal(states ...State) {
+	r.mutable()
+	if r.terminals == nil {
+		r.terminals = make(map[State]bool)
+	}
+	for _, s := range states {
+		r.terminals[s] = true
+	}
+}
+
+// IsTerminal reports whether the state was marked terminal
+func (r *RuleSet) IsTerminal(s State) bool {
+	return r.terminals[s]
+}
+
+// SetParent nests child within parent: the rules for transitions from
+// parent (and its own ancestors) also apply to child, tried after the
+// rules from child itself at the same priority.
+func (r *RuleSet) SetParent(child, parent State) {
+	r.mutable()
+	if r.parents == nil {
+		r.parents = make(map[State]State)
+	}
+	r.parents[child] = parent
+}
+
+// lineage returns s followed by its ancestors and finally AnyState,
+// the order in which rules from s are looked up.
+func (r *RuleSet) lineage(s State) []State {
+	lineage := []State{s}
+	seen := map[State]bool{s: true}
+	for {
+		parent, ok := r.parents[s]
+		if !ok || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		lineage = append(lineage, parent)
+		s = parent
+	}
+	return append(lineage, AnyState)
+}
+
+// event looks up the named event defined for the origin state,
+// falling back to events defined for its ancestors and from AnyState.
+func (r *RuleSet) event(origin State, name string) (Event, bool) {
+	for _, from := range r.lineage(origin) {
+		if e, ok := r.events[eventKey{from, name}]; ok {
+			e.From = origin
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// candidates returns the rules matching the transition from origin to
+// goal: those from origin, its ancestors and AnyState, in that order,
+// stably sorted by descending priority.
+func (r *RuleSet) candidates(origin, goal State) []Transition {
+	var ts []Transition
+	for _, from := range r.lineage(origin) {
+		t := T{from, goal}
+		if _, ok := r.rules[t]; ok {
+			ts = append(ts, t)
+		}
+	}
+	sort.SliceStable(ts, func(i, j int) bool {
+		return r.priorities[ts[i]] > r.priorities[ts[j]]
 	})
+	return ts
+}
+
+// SetStart declares the state machines using the rule set begin in
+func (r *RuleSet) SetStart(s State) {
+	r.mutable()
+	r.start = s
+	r.hasStart = true
+}
+
+// Start returns the declared start state, State(0) if none was set
+func (r *RuleSet) Start() State { return r.start }
+
+// NewSubject returns a SafeState in the start state
+func (r *RuleSet) NewSubject() Stater { return NewSafeState(r.start) }
+
+// Tracer receives how long each guard of a transition took and whether
+// it passed. Guards run in parallel, so it may be called concurrently.
+type Tracer func(t Transition, guardName string, d time.Duration, passed bool)
+
+// OnEnter registers a callback fired whenever any subject enters s
+// through the rule set: by Transition, TransitionBatch, or any Machine
+// using it. Machines run it once their outermost call has completed, so
+// never for a state entered by a step that was rolled back; see
+// Machine.Transition.
+func (r *RuleSet) OnEnter(s State, fn func(subject Stater)) {
+	r.mutable()
+	if r.entered == nil {
+		r.entered = make(map[State][]func(subject Stater))
+	}
+	r.entered[s] = append(r.entered[s], fn)
+}
+
+// enter runs the OnEnter callbacks for the subject's new state
+func (r *RuleSet) enter(subject Stater, s State) {
+	for _, fn := range r.entered[s] {
+		fn(subject)
+	}
+}
+
+// SetTracer sets the function traced guard evaluations are reported to
+func (r *RuleSet) SetTracer(fn Tracer) {
+	r.mutable()
+	r.tracer = fn
+}
+
+// SetGuardConcurrency limits how many guards of a transition are run at
+// once, queueing the rest, to protect resources the guards share. A guard
+// given up on after a timeout counts against n until it returns.
+// n <= 0 runs every guard at once, which is the default.
+func (r *RuleSet) SetGuardConcurrency(n int) {
+	r.mutable()
+	r.concurrency = n
+}
+
+// Freeze makes the rule set read-only: from then on every method changing
+// it panics with ErrFrozen, while evaluating transitions works as before.
+// A Clone of a frozen rule set is not frozen.
+func (r *RuleSet) Freeze() { r.frozen = true }
+
+// Frozen reports whether Freeze was called
+func (r *RuleSet) Frozen() bool { return r.frozen }
+
+// mutable panics unless the rule set may be changed
+func (r *RuleSet) mutable() {
+	if r.frozen {
+		panic(ErrFrozen)
+	}
 }
 
 // CreateRuleSet will establish a ruleset with the provided transitions.
@@ -61,66 +690,471 @@ func CreateRuleSet(transitions ...Transition) RuleSet {
 	return r
 }
 
+// Clone returns a deep copy of the rule set; adding rules to the clone
+// never affects the original. Guards themselves are shared.
+func (r *RuleSet) Clone() RuleSet {
+	c := RuleSet{
+		global:      append([]guard(nil), r.global...),
+		start:       r.start,
+		hasStart:    r.hasStart,
+		tracer:      r.tracer,
+		concurrency: r.concurrency,
+	}
+
+	if r.rules != nil {
+		c.rules = make(map[Transition][]guard, len(r.rules))
+		for t, guards := range r.rules {
+			c.rules[t] = append([]guard(nil), guards...)
+		}
+	}
+	if r.events != nil {
+		c.events = make(map[eventKey]Event, len(r.events))
+		for k, e := range r.events {
+			c.events[k] = e
+		}
+	}
+	if r.parents != nil {
+		c.parents = make(map[State]State, len(r.parents))
+		for child, parent := range r.parents {
+			c.parents[child] = parent
+		}
+	}
+	if r.priorities != nil {
+		c.priorities = make(map[Transition]int, len(r.priorities))
+		for t, p := range r.priorities {
+			c.priorities[t] = p
+		}
+	}
+	if r.terminals != nil {
+		c.terminals = make(map[State]bool, len(r.terminals))
+		for s := range r.terminals {
+			c.terminals[s] = true
+		}
+	}
+	if r.groups != nil {
+		c.groups = make(map[string][]State, len(r.groups))
+		for group, states := range r.groups {
+			c.groups[group] = append([]State(nil), states...)
+		}
+	}
+	if r.entered != nil {
+		c.entered = make(map[State][]func(subject Stater), len(r.entered))
+		for s, fns := range r.entered {
+			c.entered[s] = append([]func(subject Stater){}, fns...)
+		}
+	}
+
+	return c
+}
+
 // Permitted determines if a transition is allowed.
 // This occurs in parallel.
 // NOTE: Guards are not halted if they are short-circuited for some
-// transition. They may continue running *after* the outcome is determined.
-func (r RuleSet) Permitted(subject Stater, goal State) bool {
-	attempt := T{subject.CurrentState(), goal}
+// transition. They may continue running *after* the outcome is determined,
+// but their results are buffered so the goroutines always exit.
+//
+// Cancellation is cooperative: the context passed to a ContextGuard is
+// cancelled as soon as the outcome is known, whether because a peer guard
+// failed or all guards returned. Guards doing slow work should watch
+// ctx.Done() and return early; their result is ignored at that point.
+func (r *RuleSet) Permitted(subject Stater, goal State) bool {
+	return r.PermittedE(subject, goal) == nil
+}
+
+// PermittedE is like Permitted but returns the error of the first failing
+// guard, or ErrInvalidTransition when no rule exists for the transition.
+func (r *RuleSet) PermittedE(subject Stater, goal State) error {
+	return r.permit(context.Background(), subject, goal)
+}
+
+// PermittedAll is like PermittedE but runs every guard instead of
+// stopping at the first failure, returning all their errors in
+// registration order; it returns none when the transition is permitted.
+// When several rules match and none passes, the errors of the rule that
+// would have been tried first are returned.
+func (r *RuleSet) PermittedAll(subject Stater, goal State) []error {
+	a := newAttempt(subject, goal)
+	if r.terminals[a.origin] {
+		return []error{ErrTerminalState}
+	}
+
+	candidates := r.candidates(a.origin, a.goal)
+	if len(candidates) == 0 {
+		return []error{ErrInvalidTransition}
+	}
+
+	ctx := context.Background()
+	opts := evalOptions{sequential: true, tracer: r.tracer}
+
+	var first []error
+	for _, t := range candidates {
+		try := *a
+		try.rule = t
+
+		var errs []error
+		for _, g := range append(r.rules[t][:len(r.rules[t]):len(r.rules[t])], r.global...) {
+			if err := opts.run(ctx, g, &try); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) == 0 {
+			return nil
+		}
+		if first == nil {
+			first = errs
+		}
+	}
+	return first
+}
+
+// PermittedContext is like Permitted but passes ctx down to the guards.
+// A cancelled context is never permitted.
+func (r *RuleSet) PermittedContext(ctx context.Context, subject Stater, goal State) bool {
+	return r.permit(ctx, subject, goal) == nil
+}
+
+// PermittedSequential is like Permitted but runs the guards one at a time
+// in registration order, stopping at the first failure.
+func (r *RuleSet) PermittedSequential(subject Stater, goal State) bool {
+	return r.evaluate(context.Background(), newAttempt(subject, goal), evalOptions{sequential: true}) == nil
+}
+
+// PermittedTimeout is like Permitted but treats any guard not returning
+// within d as a failure. The context of a timed out ContextGuard is
+// cancelled; a guard ignoring it is left to finish in the background.
+func (r *RuleSet) PermittedTimeout(subject Stater, goal State, d time.Duration) bool {
+	return r.evaluate(context.Background(), newAttempt(subject, goal), evalOptions{timeout: d}) == nil
+}
+
+// Transition moves subject to the goal state if permitted, without
+// allocating a Machine. It returns the same errors as Machine.Transition
+// but runs no callbacks, and calls on the same subject are not serialized.
+func (r *RuleSet) Transition(subject Stater, goal State) error {
+	return r.transition(context.Background(), subject, goal)
+}
+
+// TransitionBatch moves each subject to the goal state as Transition
+// does, using a bounded pool of goroutines, and returns the errors aligned
+// with subjects. Subjects not yet attempted when ctx is done get
+// ctx.Err(). The subjects must be distinct.
+func (r *RuleSet) TransitionBatch(ctx context.Context, subjects []Stater, goal State) []error {
+	errs := make([]error, len(subjects))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(subjects) {
+		workers = len(subjects)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = r.transition(ctx, subjects[i], goal)
+			}
+		}()
+	}
+
+	for i := range subjects {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
 
-	if guards, ok := r[attempt]; ok {
-		outcome := make(chan bool)
+	return errs
+}
 
-		for _, guard := range guards {
-			go func(g Guard) {
-				outcome <- g(subject, goal)
-			}(guard)
+func (r *RuleSet) transition(ctx context.Context, subject Stater, goal State) error {
+	a := newAttempt(subject, goal)
+	if err := r.evaluate(ctx, a, evalOptions{}); err != nil {
+		if err == ErrInvalidTransition {
+			err = &InvalidTransitionError{From: a.origin, To: a.goal}
 		}
+		return err
+	}
+
+	subject.SetState(goal)
+	r.enter(subject, goal)
+	return nil
+}
+
+// permit evaluates the guards of the attempted transition in parallel,
+// returning ctx.Err() as soon as the context is done.
+func (r *RuleSet) permit(ctx context.Context, subject Stater, goal State) error {
+	return r.evaluate(ctx, newAttempt(subject, goal), evalOptions{})
+}
+
+func newAttempt(subject Stater, goal State) *attempt {
+	return &attempt{subject: subject, origin: subject.CurrentState(), goal: goal}
+}
+
+// evalOptions control how the guards of an attempt are run
+type evalOptions struct {
+	// sequential runs the guards in registration order instead of in parallel
+	sequential bool
+
+	// timeout fails each guard not returning in time with ErrGuardTimeout
+	timeout time.Duration
+
+	// tracer is the rule set's Tracer, if any
+	tracer Tracer
+
+	// concurrency limits how many guards run at once; <= 0 is unlimited
+	concurrency int
+
+	// slots holds a token for each running guard when concurrency is
+	// limited, including guards abandoned after a timeout
+	slots chan struct{}
+}
+
+// release frees the slot of a guard that has returned
+func (opts evalOptions) release() {
+	if opts.slots != nil {
+		<-opts.slots
+	}
+}
+
+// evaluate tries each rule matching the attempted transition, returning
+// nil for the first whose guards pass or else the failure of the first.
+func (r *RuleSet) evaluate(ctx context.Context, a *attempt, opts evalOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.terminals[a.origin] {
+		return ErrTerminalState
+	}
+
+	candidates := r.candidates(a.origin, a.goal)
+	if len(candidates) == 0 {
+		return ErrInvalidTransition // No rule found for the transition
+	}
+
+	opts.tracer = r.tracer
+	opts.concurrency = r.concurrency
+
+	var first error
+	for _, t := range candidates {
+		guards := append(r.rules[t][:len(r.rules[t]):len(r.rules[t])], r.global...)
+
+		// guards of a failed candidate may still be running, so each
+		// candidate gets its own copy of the attempt
+		try := *a
+		try.rule = t
+
+		err := opts.check(ctx, guards, &try)
+		if err == nil {
+			a.rule = t
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// check runs the guards, either in parallel or sequentially, returning
+// the first failure.
+func (opts evalOptions) check(ctx context.Context, guards []guard, a *attempt) error {
+	if opts.sequential {
+		for _, g := range guards {
+			if err := opts.run(ctx, g, a); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return nil // All guards passed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outcome := make(chan error, len(guards))
+
+	queue := make(chan guard, len(guards))
+	for _, g := range guards {
+		queue <- g
+	}
+	close(queue)
 
-		for range guards {
-			select {
-			case o := <-outcome:
-				if !o {
-					return false
+	workers := len(guards)
+	if opts.concurrency > 0 && opts.concurrency < workers {
+		workers = opts.concurrency
+		opts.slots = make(chan struct{}, workers)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for g := range queue {
+				if opts.slots != nil {
+					opts.slots <- struct{}{}
+				}
+				if err := ctx.Err(); err != nil {
+					opts.release()
+					outcome <- err // queued guards are skipped once done
+					continue
 				}
+				outcome <- opts.run(ctx, g, a)
+			}
+		}()
+	}
+
+	for range guards {
+		select {
+		case err := <-outcome:
+			if err != nil {
+				return err
 			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
 
-		return true // All guards passed
+	return nil // All guards passed
+}
+
+// run calls a single guard, giving up with ErrGuardTimeout once the
+// timeout elapses. A plain rejection is reported as an
+// *InvalidTransitionError naming the guard.
+func (opts evalOptions) run(ctx context.Context, g guard, a *attempt) error {
+	start := time.Now()
+	err := opts.call(ctx, g, a)
+	if opts.tracer != nil {
+		opts.tracer(a.rule, g.name, time.Since(start), err == nil)
+	}
+	if err == ErrInvalidTransition {
+		err = &InvalidTransitionError{From: a.origin, To: a.goal, Guard: g.name}
 	}
-	return false // No rule found for the transition
+	return err
 }
 
-// Stater can be passed into the FSM. The Stater is responsible for setting
-// its own default state. Behavior of a Stater without a State is undefined.
-type Stater interface {
-	CurrentState() State
-	SetState(State)
+// call runs the guard, abandoning it once the timeout elapses or, when
+// guards run sequentially, once ctx is done; in parallel check watches ctx.
+func (opts evalOptions) call(ctx context.Context, g guard, a *attempt) error {
+	parent := ctx
+	var cancelled <-chan struct{}
+	if opts.sequential {
+		cancelled = parent.Done()
+	}
+	if opts.timeout <= 0 && cancelled == nil {
+		defer opts.release()
+		return g.call(ctx, a)
+	}
+
+	var expired <-chan time.Time
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+
+		timer := time.NewTimer(opts.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	done := make(chan error, 1) // buffered so an abandoned guard can exit
+	go func() {
+		defer opts.release()
+		done <- g.call(ctx, a)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-expired:
+		return ErrGuardTimeout
+	case <-cancelled:
+		return parent.Err()
+	}
 }
 
-// Machine is a pairing of Rules and a Subject.
-// The subject or rules may be changed at any time within
-// the machine's lifecycle.
-type Machine struct {
-	Rules   *RuleSet
-	Subject Stater
+// Transitions returns every rule's transition sorted by origin then exit
+func (r *RuleSet) Transitions() []Transition {
+	ts := make([]Transition, 0, len(r.rules))
+	for t := range r.rules {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Origin() != ts[j].Origin() {
+			return ts[i].Origin() < ts[j].Origin()
+		}
+		return ts[i].Exit() < ts[j].Exit()
+	})
+	return ts
 }
 
-// Transition attempts to move the Subject to the Goal state.
-func (m Machine) Transition(goal State) error {
-	if m.Rules.Permitted(m.Subject, goal) {
-		m.Subject.SetState(goal)
-		return nil
+// States returns the sorted, de-duplicated union of all transition
+// origins and exits. AnyState is not included.
+func (r *RuleSet) States() []State {
+	seen := map[State]bool{AnyState: true}
+	var states []State
+	for t := range r.rules {
+		for _, s := range []State{t.Origin(), t.Exit()} {
+			if !seen[s] {
+				seen[s] = true
+				states = append(states, s)
+			}
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	return states
+}
+
+// hasExit reports whether any rule leads to s
+func (r *RuleSet) hasExit(s State) bool {
+	for t := range r.rules {
+		if t.Exit() == s {
+			return true
+		}
 	}
+	return false
+}
 
-	return ErrInvalidTransition
+// Adjacency returns, for each state with outgoing transitions, the sorted
+// goals reachable from it by rule structure, ignoring guards. Transitions
+// from AnyState and from ancestors are included for every state.
+func (r *RuleSet) Adjacency() map[State][]State {
+	adj := make(map[State][]State)
+	for _, s := range r.States() {
+		if goals := r.goals(s); len(goals) > 0 {
+			adj[s] = goals
+		}
+	}
+	return adj
 }
 
-// New initializes a machine
-func New(rules *RuleSet, subject Stater) *Machine {
-	m := &Machine{
-		Rules:   rules,
-		Subject: subject,
+// goals returns the sorted exits of every rule originating from the
+// state, including those inherited from its ancestors and AnyState.
+// A terminal state has no goals.
+func (r *RuleSet) goals(origin State) []State {
+	if r.terminals[origin] {
+		return nil
+	}
+
+	from := make(map[State]bool)
+	for _, s := range r.lineage(origin) {
+		from[s] = true
+	}
+
+	seen := make(map[State]bool)
+	var goals []State
+	for t := range r.rules {
+		if from[t.Origin()] && !seen[t.Exit()] {
+			seen[t.Exit()] = true
+			goals = append(goals, t.Exit())
+		}
 	}
-	return m
+	sort.Slice(goals, func(i, j int) bool { return goals[i] < goals[j] })
+	return goals
 }
@@ -0,0 +1,209 @@
+package fsm
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// thing is the subject used throughout the tests
+type thing struct{ s State }
+
+func (t *thing) CurrentState() State { return t.s }
+func (t *thing) SetState(s State)    { t.s = s }
+
+func TestPermittedNoGoroutineLeak(t *testing.T) {
+	r := CreateRuleSet(T{0, 1})
+	r.AddRule(T{0, 1}, func(Stater, State) bool { return false })
+	for i := 0; i < 4; i++ {
+		r.AddRule(T{0, 1}, func(Stater, State) bool {
+			time.Sleep(time.Millisecond)
+			return true
+		})
+	}
+
+	base := runtime.NumGoroutine()
+	for i := 0; i < 2000; i++ {
+		if r.Permitted(&thing{}, 1) {
+			t.Fatal("permitted despite a failing guard")
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > base+2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, %d before", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGuardPanic(t *testing.T) {
+	newRules := func() RuleSet {
+		r := CreateRuleSet(T{0, 1})
+		r.AddRule(T{0, 1}, func(Stater, State) bool { panic("boom") })
+		return r
+	}
+
+	t.Run("parallel", func(t *testing.T) {
+		r := newRules()
+		if err := r.PermittedE(&thing{}, 1); !errors.Is(err, ErrGuardPanic) {
+			t.Fatalf("PermittedE = %v, want ErrGuardPanic", err)
+		}
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		r := newRules()
+		if r.PermittedSequential(&thing{}, 1) {
+			t.Fatal("PermittedSequential with a panicking guard")
+		}
+
+		m := New(&r, &thing{})
+		m.SetSequential(true)
+		if err := m.Transition(1); !errors.Is(err, ErrGuardPanic) {
+			t.Fatalf("Transition = %v, want ErrGuardPanic", err)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		r := newRules()
+		errs := r.PermittedAll(&thing{}, 1)
+		if len(errs) != 1 || !errors.Is(errs[0], ErrGuardPanic) {
+			t.Fatalf("PermittedAll = %v, want [ErrGuardPanic]", errs)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := newRules()
+		m := New(&r, &thing{})
+		m.SetGuardTimeout(time.Second)
+		if err := m.Transition(1); !errors.Is(err, ErrGuardPanic) {
+			t.Fatalf("Transition = %v, want ErrGuardPanic", err)
+		}
+	})
+}
+
+func TestCloneIsolation(t *testing.T) {
+	r := CreateRuleSet(T{0, 1})
+	r.AddEvent("open", 0, 1)
+	r.MarkTerminal(2)
+	r.Tag("active", 1)
+	entered := 0
+	r.OnEnter(1, func(Stater) { entered++ })
+
+	c := r.Clone()
+	c.AddRule(T{0, 1}, func(Stater, State) bool { return false })
+	c.AddTransition(T{1, 2})
+	c.AddEvent("close", 1, 2)
+	c.MarkTerminal(3)
+	c.Tag("active", 2)
+	c.OnEnter(1, func(Stater) { entered += 10 })
+
+	if !r.Permitted(&thing{0}, 1) || r.Permitted(&thing{1}, 2) {
+		t.Fatal("rules added to the clone changed the original")
+	}
+	if len(r.events) != 1 {
+		t.Fatalf("original has %d events, want 1", len(r.events))
+	}
+	if r.IsTerminal(3) || !c.IsTerminal(2) {
+		t.Fatal("terminal states aren't independent")
+	}
+	if g := r.Group("active"); len(g) != 1 {
+		t.Fatalf("original group = %v, want [1]", g)
+	}
+	if err := r.Transition(&thing{0}, 1); err != nil || entered != 1 {
+		t.Fatalf("Transition = %v with %d OnEnter calls, want 1", err, entered)
+	}
+
+	r.AddTransition(T{1, 0})
+	if c.Permitted(&thing{1}, 0) {
+		t.Fatal("rules added to the original changed the clone")
+	}
+}
+
+// edge is a Transition implementation other than T
+type edge struct{ from, to State }
+
+func (e edge) Origin() State { return e.from }
+func (e edge) Exit() State   { return e.to }
+
+// edges is a Transition implementation that is not comparable
+type edges struct{ states []State }
+
+func (e edges) Origin() State { return e.states[0] }
+func (e edges) Exit() State   { return e.states[1] }
+
+func TestTransitionImplementations(t *testing.T) {
+	if !TransitionEqual(edge{0, 1}, T{0, 1}) || TransitionEqual(edge{0, 1}, T{1, 0}) {
+		t.Fatal("TransitionEqual doesn't compare by Origin and Exit")
+	}
+	if Transition(edge{0, 1}) == Transition(T{0, 1}) {
+		t.Fatal("interface values of different types compared equal")
+	}
+
+	r := RuleSet{}
+	r.AddTransition(edge{0, 1})
+	if r.Permitted(&thing{0}, 1) {
+		t.Fatal("a rule keyed by a non-T Transition was consulted")
+	}
+	r.AddTransition(T{0, 1})
+	if !r.Permitted(&thing{0}, 1) {
+		t.Fatal("the rule keyed by T wasn't consulted")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic adding a non-comparable Transition")
+		}
+	}()
+	r.AddTransition(edges{[]State{1, 2}})
+}
+
+func TestGuardConcurrencyWithTimeout(t *testing.T) {
+	var running, most atomic.Int32
+	slow := func(Stater, State) bool {
+		n := running.Add(1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(30 * time.Millisecond)
+		running.Add(-1)
+		return true
+	}
+
+	r := CreateRuleSet(T{0, 1})
+	for i := 0; i < 3; i++ {
+		r.AddRule(T{0, 1}, slow)
+	}
+	r.SetGuardConcurrency(1)
+
+	for i := 0; i < 10; i++ {
+		if r.PermittedTimeout(&thing{}, 1, 10*time.Millisecond) {
+			t.Fatal("permitted although every guard timed out")
+		}
+		for running.Load() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if n := most.Load(); n > 1 {
+		t.Fatalf("%d guards ran at once with a limit of 1", n)
+	}
+}
+
+func TestRemoveLastRule(t *testing.T) {
+	flag := func(Stater, State) bool { return true }
+	r := RuleSet{}
+	r.AddRulePriority(T{0, 1}, 5, flag)
+	if !r.Permitted(&thing{0}, 1) {
+		t.Fatal("not permitted with the flag guard")
+	}
+
+	r.RemoveRule(T{0, 1}, flag)
+	if r.Permitted(&thing{0}, 1) {
+		t.Fatal("permitted after removing the rule's only guard")
+	}
+	if len(r.Transitions()) != 0 || len(r.priorities) != 0 {
+		t.Fatalf("rule left behind: %v, priorities %v", r.Transitions(), r.priorities)
+	}
+}
@@ -0,0 +1,50 @@
+// Package fsmtest provides assertions for testing state machines, with
+// failure messages using registered state names.
+package fsmtest
+
+import (
+	"testing"
+
+	"github.com/stn81/fsm"
+)
+
+// AssertCanTransition fails the test unless the machine's subject is
+// permitted to move to the goal state. Nothing is moved.
+func AssertCanTransition(t testing.TB, m *fsm.Machine, goal fsm.State) {
+	t.Helper()
+
+	if !m.CanTransition(goal) {
+		t.Errorf("expected transition from %s to %s to be permitted", m.Subject.CurrentState(), goal)
+	}
+}
+
+// AssertCannotTransition fails the test if the machine's subject is
+// permitted to move to the goal state. Nothing is moved.
+func AssertCannotTransition(t testing.TB, m *fsm.Machine, goal fsm.State) {
+	t.Helper()
+
+	if m.CanTransition(goal) {
+		t.Errorf("expected transition from %s to %s to be denied", m.Subject.CurrentState(), goal)
+	}
+}
+
+// AssertState fails the test unless the machine's subject is in the
+// wanted state.
+func AssertState(t testing.TB, m *fsm.Machine, want fsm.State) {
+	t.Helper()
+
+	if got := m.Subject.CurrentState(); got != want {
+		t.Errorf("expected state %s, got %s", want, got)
+	}
+}
+
+// AssertTransition moves the machine's subject to the goal state,
+// failing the test if the transition returns an error.
+func AssertTransition(t testing.TB, m *fsm.Machine, goal fsm.State) {
+	t.Helper()
+
+	from := m.Subject.CurrentState()
+	if err := m.Transition(goal); err != nil {
+		t.Errorf("transition from %s to %s failed: %v", from, goal, err)
+	}
+}
@@ -0,0 +1,203 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+)
+
+// StaterOf is a Stater whose states are of any comparable type S
+type StaterOf[S comparable] interface {
+	CurrentState() S
+	SetState(S)
+}
+
+// GuardOf is a Guard over states of type S
+type GuardOf[S comparable] func(subject StaterOf[S], goal S) bool
+
+// TransitionOf is the change between two states of type S
+type TransitionOf[S comparable] struct {
+	O, E S
+}
+
+// unknownState stands for a subject state no rule refers to
+const unknownState State = -2
+
+// RuleSetOf stores the rules for a state machine over states of type S,
+// such as strings or a custom enum. It is evaluated exactly like RuleSet.
+type RuleSetOf[S comparable] struct {
+	rules  RuleSet
+	ids    map[S]State
+	states []S
+}
+
+// id returns the internal state for s, allocating one if needed
+func (r *RuleSetOf[S]) id(s S) State {
+	if id, ok := r.ids[s]; ok {
+		return id
+	}
+	if r.ids == nil {
+		r.ids = make(map[S]State)
+	}
+	id := State(len(r.states))
+	r.ids[s] = id
+	r.states = append(r.states, s)
+	return id
+}
+
+// lookup returns the internal state for s without allocating one
+func (r *RuleSetOf[S]) lookup(s S) State {
+	if id, ok := r.ids[s]; ok {
+		return id
+	}
+	return unknownState
+}
+
+func (r *RuleSetOf[S]) t(t TransitionOf[S]) T {
+	return T{r.id(t.O), r.id(t.E)}
+}
+
+// AddTransition adds a transition with a default rule
+func (r *RuleSetOf[S]) AddTransition(t TransitionOf[S]) {
+	r.rules.AddTransition(r.t(t))
+}
+
+// AddRule adds Guards for the given Transition
+func (r *RuleSetOf[S]) AddRule(t TransitionOf[S], guards ...GuardOf[S]) {
+	for _, guard := range guards {
+		g := guard
+		r.rules.AddRule(r.t(t), func(subject Stater, goal State) bool {
+			return g(subject.(*staterOf[S]).subject, r.states[goal])
+		})
+	}
+}
+
+// Permitted determines if a transition is allowed; see RuleSet.Permitted
+func (r *RuleSetOf[S]) Permitted(subject StaterOf[S], goal S) bool {
+	return r.rules.Permitted(&staterOf[S]{subject: subject, rules: r}, r.lookup(goal))
+}
+
+// States returns every state referenced by the rules, in the order they
+// were first added.
+func (r *RuleSetOf[S]) States() []S {
+	return append([]S(nil), r.states...)
+}
+
+// CreateRuleSetOf will establish a ruleset with the provided transitions.
+func CreateRuleSetOf[S comparable](transitions ...TransitionOf[S]) *RuleSetOf[S] {
+	r := &RuleSetOf[S]{}
+	for _, t := range transitions {
+		r.AddTransition(t)
+	}
+	return r
+}
+
+// staterOf adapts a StaterOf to the internal states of its rules
+type staterOf[S comparable] struct {
+	subject StaterOf[S]
+	rules   *RuleSetOf[S]
+}
+
+func (s *staterOf[S]) CurrentState() State { return s.rules.lookup(s.subject.CurrentState()) }
+func (s *staterOf[S]) SetState(id State)   { s.subject.SetState(s.rules.states[id]) }
+
+// MachineOf is a pairing of Rules and a Subject over states of type S.
+// It behaves like Machine, including serializing its transitions.
+type MachineOf[S comparable] struct {
+	rules   *RuleSetOf[S]
+	subject StaterOf[S]
+	m       *Machine
+}
+
+// NewOf initializes a machine over states of type S
+func NewOf[S comparable](rules *RuleSetOf[S], subject StaterOf[S]) *MachineOf[S] {
+	return &MachineOf[S]{
+		rules:   rules,
+		subject: subject,
+		m:       New(&rules.rules, &staterOf[S]{subject: subject, rules: rules}),
+	}
+}
+
+// Subject returns the machine's subject
+func (m *MachineOf[S]) Subject() StaterOf[S] { return m.subject }
+
+// Transition attempts to move the Subject to the goal state;
+// see Machine.Transition.
+func (m *MachineOf[S]) Transition(goal S) error {
+	return m.TransitionContext(context.Background(), goal)
+}
+
+// TransitionContext is like Transition but passes ctx down to the guards.
+// A failure is returned as a *TransitionErrorOf.
+func (m *MachineOf[S]) TransitionContext(ctx context.Context, goal S) error {
+	from := m.subject.CurrentState()
+	err := m.m.TransitionContext(ctx, m.rules.lookup(goal))
+	if err == nil {
+		return nil
+	}
+	return &TransitionErrorOf[S]{From: from, To: goal, Err: err, msg: m.rules.describe(err)}
+}
+
+// TransitionErrorOf is the failure of a MachineOf transition, naming the
+// states by their values of type S.
+type TransitionErrorOf[S comparable] struct {
+	From, To S
+
+	// Err is the cause, such as a guard's error or an
+	// *InvalidTransitionError; the states it holds are the rule set's
+	// internal ones, so use From and To instead.
+	Err error
+
+	msg string
+}
+
+func (e *TransitionErrorOf[S]) Error() string {
+	if _, ok := e.Err.(*InvalidTransitionError); ok {
+		return fmt.Sprintf("%v from %v to %v%s", ErrInvalidTransition, e.From, e.To, e.msg)
+	}
+	return fmt.Sprintf("transition from %v to %v: %s", e.From, e.To, e.msg)
+}
+
+// Unwrap returns the cause
+func (e *TransitionErrorOf[S]) Unwrap() error { return e.Err }
+
+// describe formats err without the internal states of the rule set. An
+// *InvalidTransitionError is reduced to what blocked it.
+func (r *RuleSetOf[S]) describe(err error) string {
+	switch e := err.(type) {
+	case *InvalidTransitionError:
+		var msg string
+		if e.Guard != "" {
+			msg += ": blocked by guard '" + e.Guard + "'"
+		}
+		if e.Reason != "" {
+			msg += ": " + e.Reason
+		}
+		return msg
+	case *stepError:
+		return fmt.Sprintf("%s %v: %s", e.step, r.state(e.state), r.describe(e.err))
+	}
+	return err.Error()
+}
+
+// state returns the value of an internal state in a message
+func (r *RuleSetOf[S]) state(id State) any {
+	if id >= 0 && int(id) < len(r.states) {
+		return r.states[id]
+	}
+	return "unknown state"
+}
+
+// CanTransition reports whether the Subject may move to the goal state
+func (m *MachineOf[S]) CanTransition(goal S) bool {
+	return m.m.CanTransition(m.rules.lookup(goal))
+}
+
+// OnEnter registers a callback fired after the subject enters the given state
+func (m *MachineOf[S]) OnEnter(s S, fn func(subject StaterOf[S])) {
+	m.m.OnEnter(m.rules.id(s), func(Stater) { fn(m.subject) })
+}
+
+// OnExit registers a callback fired before the subject leaves the given state
+func (m *MachineOf[S]) OnExit(s S, fn func(subject StaterOf[S])) {
+	m.m.OnExit(m.rules.id(s), func(Stater) { fn(m.subject) })
+}
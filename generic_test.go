@@ -0,0 +1,48 @@
+package fsm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type stringThing struct{ s string }
+
+func (t *stringThing) CurrentState() string { return t.s }
+func (t *stringThing) SetState(s string)    { t.s = s }
+
+// closedCondition blocks every transition
+type closedCondition struct{}
+
+func (closedCondition) Check(Stater, State) (bool, string) { return false, "closed for review" }
+
+func TestMachineOfErrors(t *testing.T) {
+	rules := CreateRuleSetOf(TransitionOf[string]{"draft", "review"}, TransitionOf[string]{"review", "done"})
+	m := NewOf(rules, &stringThing{"draft"})
+
+	errFull := errors.New("queue full")
+	m.m.OnEnterE(rules.id("review"), func(Stater) error { return errFull })
+	err := m.Transition("review")
+	if !errors.Is(err, errFull) {
+		t.Fatalf("Transition = %v, want it to wrap the callback's error", err)
+	}
+	if msg := err.Error(); msg != "transition from draft to review: entering review: queue full" {
+		t.Fatalf("Error() = %q", msg)
+	}
+
+	rules.rules.AddConditions(rules.t(TransitionOf[string]{"draft", "done"}), closedCondition{})
+	err = m.Transition("done")
+	var invalid *InvalidTransitionError
+	if !errors.As(err, &invalid) || invalid.Reason != "closed for review" {
+		t.Fatalf("Transition = %v, want an *InvalidTransitionError with the reason", err)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "invalid transition from draft to done: ") ||
+		!strings.HasSuffix(msg, ": closed for review") || strings.Contains(msg, "State(") {
+		t.Fatalf("Error() = %q", msg)
+	}
+
+	var typed *TransitionErrorOf[string]
+	if !errors.As(err, &typed) || typed.From != "draft" || typed.To != "done" {
+		t.Fatalf("Transition = %v, want a *TransitionErrorOf[string]", err)
+	}
+}
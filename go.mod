@@ -0,0 +1,3 @@
+module github.com/stn81/fsm
+
+go 1.21
@@ -0,0 +1,71 @@
+package fsm
+
+// FindCycles returns every simple cycle in the rule graph, ignoring
+// guards. Each cycle starts at its lowest state and lists each state once;
+// a self-loop is a cycle of one state. Cycles are ordered by their states.
+func (r *RuleSet) FindCycles() [][]State {
+	adj := r.Adjacency()
+
+	var cycles [][]State
+	for _, start := range r.States() {
+		// only search through states above start so each cycle is found
+		// once, from its lowest state
+		var path []State
+		onPath := make(map[State]bool)
+
+		var visit func(s State)
+		visit = func(s State) {
+			path = append(path, s)
+			onPath[s] = true
+
+			for _, next := range adj[s] {
+				switch {
+				case next == start:
+					cycles = append(cycles, append([]State(nil), path...))
+				case next > start && !onPath[next]:
+					visit(next)
+				}
+			}
+
+			onPath[s] = false
+			path = path[:len(path)-1]
+		}
+		visit(start)
+	}
+	return cycles
+}
+
+// ShortestPath returns the fewest states leading from one state to
+// another by rule structure, ignoring guards, starting with from and
+// ending with to, and whether any path exists. The path from a state to
+// itself is just that state.
+func (r *RuleSet) ShortestPath(from, to State) ([]State, bool) {
+	if from == to {
+		return []State{from}, true
+	}
+
+	prev := map[State]State{from: from}
+	queue := []State{from}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		for _, next := range r.goals(s) {
+			if _, seen := prev[next]; seen {
+				continue
+			}
+			prev[next] = s
+
+			if next == to {
+				path := []State{to}
+				for s := to; s != from; {
+					s = prev[s]
+					path = append([]State{s}, path...)
+				}
+				return path, true
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,53 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoSuchGroup no state was tagged with the group
+var ErrNoSuchGroup = errors.New("no such group")
+
+// Tag adds states to the named group, for use with AddGroupTransition
+func (r *RuleSet) Tag(group string, states ...State) {
+	r.mutable()
+	if r.groups == nil {
+		r.groups = make(map[string][]State)
+	}
+	for _, s := range states {
+		if !containsState(r.groups[group], s) {
+			r.groups[group] = append(r.groups[group], s)
+		}
+	}
+}
+
+// Group returns the states tagged with the group, in tagging order
+func (r *RuleSet) Group(group string) []State {
+	return append([]State(nil), r.groups[group]...)
+}
+
+// AddGroupTransition adds a transition with the given Guards from every
+// state of one group to every state of another, skipping transitions from
+// a state to itself. The groups are expanded when it is called, into
+// concrete transitions listed by Transitions; states tagged later are not
+// included. ErrNoSuchGroup is returned, without adding anything, for a
+// group no state was tagged with.
+func (r *RuleSet) AddGroupTransition(fromGroup, toGroup string, guards ...Guard) error {
+	for _, group := range []string{fromGroup, toGroup} {
+		if len(r.groups[group]) == 0 {
+			return fmt.Errorf("%w: %q", ErrNoSuchGroup, group)
+		}
+	}
+
+	for _, from := range r.groups[fromGroup] {
+		for _, to := range r.groups[toGroup] {
+			if from == to {
+				continue
+			}
+			t := T{from, to}
+			r.AddTransition(t)
+			r.AddRule(t, guards...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package fsm
+
+import "time"
+
+// And returns a Guard permitting the transition only when all guards do.
+// Guards run in order and evaluation stops at the first failure.
+func And(guards ...Guard) Guard {
+	return func(subject Stater, goal State) bool {
+		for _, g := range guards {
+			if !g(subject, goal) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a Guard permitting the transition when any of the guards do.
+// Guards run in order and evaluation stops at the first success.
+func Or(guards ...Guard) Guard {
+	return func(subject Stater, goal State) bool {
+		for _, g := range guards {
+			if g(subject, goal) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a Guard permitting the transition when g does not
+func Not(g Guard) Guard {
+	return func(subject Stater, goal State) bool {
+		return !g(subject, goal)
+	}
+}
+
+// MinTimeInState returns a Guard permitting the transition only once the
+// subject has been in its current state for at least d. Subjects that are
+// not a TimedStater are never permitted.
+func MinTimeInState(d time.Duration) Guard {
+	return func(subject Stater, goal State) bool {
+		timed, ok := subject.(TimedStater)
+		return ok && time.Since(timed.StateEnteredAt()) >= d
+	}
+}
+
+// ApprovalGuard returns a Guard that waits for an approval on ch,
+// permitting the transition when it receives true. Receiving false, ch
+// being closed, or no value arriving within timeout denies it; timeout
+// <= 0 waits indefinitely. Every evaluation consumes one value, so one
+// approval permits one evaluation. The guard isn't cancelled with the
+// transition; use SetGuardTimeout to bound every guard.
+func ApprovalGuard(ch <-chan bool, timeout time.Duration) Guard {
+	return func(subject Stater, goal State) bool {
+		if timeout <= 0 {
+			return <-ch
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case approved := <-ch:
+			return approved
+		case <-timer.C:
+			return false
+		}
+	}
+}
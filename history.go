@@ -0,0 +1,70 @@
+package fsm
+
+import "time"
+
+// HistoryEntry records a single transition attempt of a Machine
+type HistoryEntry struct {
+	From, To State
+	Time     time.Time
+
+	// Err is the reason a failed transition was rejected; it is only
+	// set for failures recorded with RecordFailures.
+	Err error
+
+	// Reset marks an entry recorded by Machine.Reset rather than a transition
+	Reset bool
+
+	// Reason is the reason given to Machine.TransitionReason
+	Reason string
+}
+
+type history struct {
+	enabled  bool
+	failures bool
+	limit    int
+	entries  []HistoryEntry
+}
+
+func (h *history) record(e HistoryEntry) {
+	if !h.enabled || (e.Err != nil && !h.failures) {
+		return
+	}
+
+	if h.limit > 0 && len(h.entries) >= h.limit {
+		n := copy(h.entries, h.entries[len(h.entries)-h.limit+1:])
+		h.entries = h.entries[:n]
+	}
+	e.Time = time.Now()
+	h.entries = append(h.entries, e)
+}
+
+// EnableHistory starts recording every successful transition
+func (m *Machine) EnableHistory() {
+	defer m.lock()()
+
+	m.history.enabled = true
+}
+
+// RecordFailures sets whether rejected transitions are recorded as well
+func (m *Machine) RecordFailures(record bool) {
+	defer m.lock()()
+
+	m.history.failures = record
+}
+
+// SetHistoryLimit keeps only the last n entries; n <= 0 is unbounded.
+func (m *Machine) SetHistoryLimit(n int) {
+	defer m.lock()()
+
+	m.history.limit = n
+	if n > 0 && len(m.history.entries) > n {
+		m.history.entries = append([]HistoryEntry(nil), m.history.entries[len(m.history.entries)-n:]...)
+	}
+}
+
+// History returns a copy of the recorded entries, oldest first
+func (m *Machine) History() []HistoryEntry {
+	defer m.lock()()
+
+	return append([]HistoryEntry(nil), m.history.entries...)
+}
@@ -0,0 +1,293 @@
+package fsm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+type ruleJSON struct {
+	Origin string   `json:"origin"`
+	Exit   string   `json:"exit"`
+	Guards []string `json:"guards,omitempty"`
+}
+
+type eventJSON struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ruleSetJSON is the encoded definition of a RuleSet, shared by the JSON
+// and YAML encodings.
+type ruleSetJSON struct {
+	States      []string    `json:"states,omitempty"`
+	Transitions []ruleJSON  `json:"transitions"`
+	Events      []eventJSON `json:"events,omitempty"`
+	Terminals   []string    `json:"terminals,omitempty"`
+	Start       string      `json:"start,omitempty"`
+}
+
+// LoadRuleSet reads a JSON encoded RuleSet from r.
+func LoadRuleSet(r io.Reader) (RuleSet, error) {
+	var rules RuleSet
+	err := json.NewDecoder(r).Decode(&rules)
+	return rules, err
+}
+
+// MarshalJSON encodes the transition graph, terminal states and start
+// state using registered state names.
+// Guards can't be encoded; only the names of guards added with
+// AddNamedRule or referenced by a previously loaded definition are kept.
+func (r RuleSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.definition())
+}
+
+// exportedGuards returns the names of the guards of t added with
+// AddNamedRule or by a loaded definition. The default rule and guards
+// known only by their function or type aren't included, as no registry
+// could resolve those names.
+func (r *RuleSet) exportedGuards(t Transition) []string {
+	var names []string
+	for _, g := range r.rules[t] {
+		if g.exported {
+			names = append(names, g.name)
+		}
+	}
+	return names
+}
+
+// definition returns the encodable definition of the rule set
+func (r *RuleSet) definition() ruleSetJSON {
+	def := ruleSetJSON{Transitions: []ruleJSON{}}
+
+	for _, s := range r.States() {
+		def.States = append(def.States, s.String())
+	}
+
+	for _, t := range r.Transitions() {
+		def.Transitions = append(def.Transitions, ruleJSON{
+			Origin: t.Origin().String(),
+			Exit:   t.Exit().String(),
+			Guards: r.exportedGuards(t),
+		})
+	}
+
+	for _, e := range r.events {
+		def.Events = append(def.Events, eventJSON{
+			Name: e.Name,
+			From: e.From.String(),
+			To:   e.To.String(),
+		})
+	}
+	sort.Slice(def.Events, func(i, j int) bool {
+		a, b := def.Events[i], def.Events[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.Name < b.Name
+	})
+
+	var terminals []State
+	for s := range r.terminals {
+		terminals = append(terminals, s)
+	}
+	sort.Slice(terminals, func(i, j int) bool { return terminals[i] < terminals[j] })
+	for _, s := range terminals {
+		def.Terminals = append(def.Terminals, s.String())
+	}
+
+	if r.hasStart {
+		def.Start = r.start.String()
+	}
+
+	return def
+}
+
+// UnmarshalJSON replaces the rules with the decoded transition graph.
+// Each transition gets the default rule; guards referenced by name are
+// recorded and must be attached afterwards with AttachGuards; until then
+// their transitions are rejected with ErrGuardNotAttached.
+func (r *RuleSet) UnmarshalJSON(data []byte) error {
+	r.mutable()
+	var def ruleSetJSON
+	if err := json.Unmarshal(data, &def); err != nil {
+		return err
+	}
+
+	rules, err := def.ruleSet()
+	if err != nil {
+		return err
+	}
+
+	*r = rules
+	return nil
+}
+
+// ruleSet builds the rule set the definition describes
+func (def ruleSetJSON) ruleSet() (RuleSet, error) {
+	rules := RuleSet{}
+	for _, name := range def.States {
+		if _, err := ParseState(name); err != nil {
+			return RuleSet{}, err
+		}
+	}
+
+	for _, rule := range def.Transitions {
+		t, err := parseTransition(rule.Origin, rule.Exit)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		rules.AddTransition(t)
+		for _, name := range rule.Guards {
+			rules.addGuard(t, unattachedGuard(t, name))
+		}
+	}
+
+	for _, event := range def.Events {
+		t, err := parseTransition(event.From, event.To)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		if _, ok := rules.rules[t]; !ok {
+			return RuleSet{}, fmt.Errorf("event %q has no transition from %s to %s", event.Name, event.From, event.To)
+		}
+		rules.addEvent(Event{Name: event.Name, From: t.O, To: t.E})
+	}
+
+	for _, name := range def.Terminals {
+		s, err := ParseState(name)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		rules.MarkTerminal(s)
+	}
+
+	if def.Start != "" {
+		start, err := ParseState(def.Start)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		rules.SetStart(start)
+	}
+
+	return rules, nil
+}
+
+// unattachedGuard stands in for the guard named by a loaded definition,
+// so the transition is rejected until the guard is attached.
+func unattachedGuard(t Transition, name string) guard {
+	err := fmt.Errorf("%w: %q on %s -> %s", ErrGuardNotAttached, name, t.Origin(), t.Exit())
+	return guard{name: name, exported: true, unattached: true, check: func(context.Context, *attempt) error {
+		return err
+	}}
+}
+
+// AttachGuards replaces the guards referenced by name in a loaded
+// definition, which reject with ErrGuardNotAttached until then. If any
+// name is unknown an error is returned and no guard is attached. Guards
+// attached by an earlier call are left as they are.
+func (r *RuleSet) AttachGuards(guards map[string]Guard) error {
+	r.mutable()
+	transitions := r.Transitions()
+	for _, t := range transitions {
+		for _, g := range r.rules[t] {
+			if _, ok := guards[g.name]; g.unattached && !ok {
+				return fmt.Errorf("unknown guard %q on %s -> %s", g.name, t.Origin(), t.Exit())
+			}
+		}
+	}
+
+	for _, t := range transitions {
+		attached := make([]guard, 0, len(r.rules[t]))
+		for _, g := range r.rules[t] {
+			if g.unattached {
+				name := g.name
+				g = guards[name].guard().named(name)
+				g.exported = true
+			}
+			attached = append(attached, g)
+		}
+		r.rules[t] = attached
+	}
+	return nil
+}
+
+// GuardRegistry names guards so definitions loaded from JSON or YAML can
+// reference them. The zero value is an empty registry ready to use.
+type GuardRegistry struct {
+	mu     sync.RWMutex
+	guards map[string]Guard
+}
+
+// Register adds guard under name. It panics if the name is already
+// registered.
+func (g *GuardRegistry) Register(name string, guard Guard) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.guards[name]; ok {
+		panic(fmt.Sprintf("fsm: guard %q registered twice", name))
+	}
+	if g.guards == nil {
+		g.guards = make(map[string]Guard)
+	}
+	g.guards[name] = guard
+}
+
+// Lookup returns the guard registered under name
+func (g *GuardRegistry) Lookup(name string) (Guard, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	guard, ok := g.guards[name]
+	return guard, ok
+}
+
+// LoadRuleSet reads a JSON encoded RuleSet as LoadRuleSet does and
+// attaches the registered guards it references, failing on any name that
+// is not registered.
+func (g *GuardRegistry) LoadRuleSet(r io.Reader) (RuleSet, error) {
+	rules, err := LoadRuleSet(r)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	if err := g.attach(&rules); err != nil {
+		return RuleSet{}, err
+	}
+	return rules, nil
+}
+
+// LoadRuleSetYAML is like LoadRuleSet for a YAML definition
+func (g *GuardRegistry) LoadRuleSetYAML(r io.Reader) (RuleSet, error) {
+	rules, err := LoadRuleSetYAML(r)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	if err := g.attach(&rules); err != nil {
+		return RuleSet{}, err
+	}
+	return rules, nil
+}
+
+func (g *GuardRegistry) attach(rules *RuleSet) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return rules.AttachGuards(g.guards)
+}
+
+func parseTransition(origin, exit string) (T, error) {
+	o, err := ParseState(origin)
+	if err != nil {
+		return T{}, err
+	}
+	e, err := ParseState(exit)
+	if err != nil {
+		return T{}, err
+	}
+	return T{o, e}, nil
+}
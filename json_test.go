@@ -0,0 +1,89 @@
+package fsm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const guardedJSON = `{"transitions": [
+	{"origin": "0", "exit": "1", "guards": ["open"]},
+	{"origin": "1", "exit": "2", "guards": ["closed"]}
+]}`
+
+func TestAttachGuardsAtomic(t *testing.T) {
+	r, err := LoadRuleSet(strings.NewReader(guardedJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(Stater, State) bool { return true }
+	if err := r.AttachGuards(map[string]Guard{"open": open}); err == nil {
+		t.Fatal("expected an error for the unknown guard")
+	}
+	if err := r.PermittedE(&thing{0}, 1); !errors.Is(err, ErrGuardNotAttached) {
+		t.Fatalf("PermittedE after a failed AttachGuards = %v, want ErrGuardNotAttached", err)
+	}
+
+	closed := func(Stater, State) bool { return false }
+	guards := map[string]Guard{"open": open, "closed": closed}
+	if err := r.AttachGuards(guards); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AttachGuards(guards); err != nil {
+		t.Fatal(err)
+	}
+	if names := r.GuardNames(T{0, 1}); len(names) != 2 || names[1] != "open" {
+		t.Fatalf("GuardNames(0 -> 1) = %v", names)
+	}
+	if names := r.GuardNames(T{1, 2}); len(names) != 2 || names[1] != "closed" {
+		t.Fatalf("GuardNames(1 -> 2) = %v", names)
+	}
+	if !r.Permitted(&thing{0}, 1) || r.Permitted(&thing{1}, 2) {
+		t.Fatal("attached guards aren't consulted")
+	}
+}
+
+func TestUnattachedGuardsReject(t *testing.T) {
+	r, err := LoadRuleSet(strings.NewReader(guardedJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Permitted(&thing{0}, 1) {
+		t.Fatal("permitted before its guard was attached")
+	}
+
+	err = New(&r, &thing{}).Transition(1)
+	if !errors.Is(err, ErrGuardNotAttached) || !strings.Contains(err.Error(), `"open"`) {
+		t.Fatalf("Transition(1) = %v, want ErrGuardNotAttached naming the guard", err)
+	}
+}
+
+func TestGuardRegistryDuplicate(t *testing.T) {
+	var g GuardRegistry
+	g.Register("open", func(Stater, State) bool { return true })
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic registering a guard twice")
+		}
+	}()
+	g.Register("open", func(Stater, State) bool { return false })
+}
+
+func TestGuardRegistryLoadRuleSet(t *testing.T) {
+	var g GuardRegistry
+	g.Register("open", func(Stater, State) bool { return true })
+	if _, err := g.LoadRuleSet(strings.NewReader(guardedJSON)); err == nil {
+		t.Fatal("expected an error for the unregistered guard")
+	}
+
+	g.Register("closed", func(Stater, State) bool { return false })
+	r, err := g.LoadRuleSet(strings.NewReader(guardedJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Permitted(&thing{0}, 1) || r.Permitted(&thing{1}, 2) {
+		t.Fatal("registered guards were not attached")
+	}
+}
@@ -0,0 +1,1035 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Callback is invoked with the subject when it enters or leaves a State.
+type Callback func(subject Stater)
+
+// ArgsCallback is like Callback but also receives the arguments passed to
+// TransitionWith; args is nil for any other transition.
+type ArgsCallback func(subject Stater, args any)
+
+// action is the form every kind of callback is stored in
+type action func(ctx context.Context, a *attempt) error
+
+// TransitionFunc attempts a transition to the goal state
+type TransitionFunc func(goal State) error
+
+// Middleware wraps a TransitionFunc with cross-cutting behavior. It may
+// inspect the goal, short-circuit by not calling next, or post-process
+// the error next returns.
+type Middleware func(next TransitionFunc) TransitionFunc
+
+// Observer is notified of the outcome of every transition attempt;
+// err is nil when the transition succeeded.
+type Observer func(from, to State, err error)
+
+// Machine is a pairing of Rules and a Subject.
+// The subject or rules may be changed at any time within
+// the machine's lifecycle; use SetSubject to do so safely while
+// transitions may be in flight.
+// Transitions on a single Machine are serialized; it must not be copied
+// after first use. Starting a transition from within a callback or
+// middleware of a transition on the same Machine fails with
+// ErrReentrantTransition; use SetAutoTransition to chain transitions.
+// Every other method may be called from a callback or middleware and runs
+// as part of the transition in progress.
+//
+// Guards must not call the Machine. Guards run in parallel, the default,
+// or with a guard timeout or a cancellable context run on goroutines of
+// their own, where any call locking the Machine deadlocks. Guards run
+// sequentially otherwise run on the transitioning goroutine and are
+// treated like callbacks: a transition fails with ErrReentrantTransition.
+type Machine struct {
+	Rules   *RuleSet
+	Subject Stater
+
+	mu         sync.Mutex
+	enter      map[State][]action
+	exit       map[State][]action
+	history    history
+	options    evalOptions
+	observers  []Observer
+	middleware []Middleware
+	rejected   []func(from, to State)
+	edges      map[T][]action
+	invariants []func(subject Stater) error
+	cooldowns  map[T]time.Duration
+	lastUsed   map[T]time.Time
+	stats      Stats
+	auto       map[State]func(subject Stater) State
+	moved      []func(subject Stater, from, to State)
+	strict     bool
+	preHooks   []func(from, to State) error
+	stateEqual func(a, b State) bool
+	logger     *slog.Logger
+	prepare    map[State][]action
+	timeouts   map[State]stateTimeout
+	timer      *time.Timer
+	timerGen   uint64
+	timerState State
+	rejections rejections
+	disabled   map[T]bool
+	async      map[State][]func(subject Stater)
+	asyncErr   func(err error)
+
+	// effects are deferred until the outermost operation completes
+	effects []func()
+
+	reasonObservers []func(from, to State, reason string, err error)
+	subscribers     map[*subscriber]bool
+	subscribePolicy SubscribePolicy
+	subscribeBuffer int
+
+	// owner is the goroutine holding mu, 0 when there is none
+	owner         atomic.Int64
+	transitioning atomic.Bool
+}
+
+// maxAutoTransitions bounds the automatic transitions following one
+// transition, breaking loops between auto transitioning states.
+const maxAutoTransitions = 32
+
+// SetSubject replaces the Subject, waiting for any in-flight transition
+// to finish, and returns the previous one. Called from a callback of a
+// transition it takes effect at once; the transition in progress carries
+// on with the previous subject.
+func (m *Machine) SetSubject(s Stater) Stater {
+	defer m.lock()()
+
+	prev := m.Subject
+	m.Subject = s
+	return prev
+}
+
+// OnEnter registers a callback fired after the subject enters the given state
+func (m *Machine) OnEnter(s State, fn func(subject Stater)) {
+	m.OnEnterWith(s, func(subject Stater, _ any) { fn(subject) })
+}
+
+// OnExit registers a callback fired before the subject leaves the given state
+func (m *Machine) OnExit(s State, fn func(subject Stater)) {
+	m.OnExitWith(s, func(subject Stater, _ any) { fn(subject) })
+}
+
+// OnEnterWith is like OnEnter but the callback receives the transition arguments
+func (m *Machine) OnEnterWith(s State, fn func(subject Stater, args any)) {
+	defer m.lock()()
+
+	m.enter = addAction(m.enter, s, func(_ context.Context, a *attempt) error {
+		fn(a.subject, a.args)
+		return nil
+	})
+}
+
+// OnEnterE registers a callback fired after the subject enters the given
+// state. If it returns an error the subject is rolled back to the state it
+// came from; see Transition.
+func (m *Machine) OnEnterE(s State, fn func(subject Stater) error) {
+	defer m.lock()()
+
+	m.enter = addAction(m.enter, s, func(_ context.Context, a *attempt) error {
+		return fn(a.subject)
+	})
+}
+
+// OnEnterResult registers a callback fired after the subject enters the
+// given state which produces a value for TransitionResult. An error rolls
+// the transition back like any enter callback; see Transition.
+func (m *Machine) OnEnterResult(s State, fn func(subject Stater) (any, error)) {
+	defer m.lock()()
+
+	m.enter = addAction(m.enter, s, func(_ context.Context, a *attempt) error {
+		result, err := fn(a.subject)
+		if err == nil {
+			a.result = result
+		}
+		return err
+	})
+}
+
+// OnEnterContext registers a callback fired after the subject enters the
+// given state, receiving the context of the transition. Returning an
+// error, such as ctx.Err(), rolls the transition back; see Transition.
+func (m *Machine) OnEnterContext(s State, fn func(ctx context.Context, subject Stater) error) {
+	defer m.lock()()
+
+	m.enter = addAction(m.enter, s, func(ctx context.Context, a *attempt) error {
+		return fn(ctx, a.subject)
+	})
+}
+
+// OnExitContext registers a callback fired before the subject leaves the
+// given state, receiving the context of the transition. Returning an
+// error, such as ctx.Err(), cancels the transition before SetState.
+func (m *Machine) OnExitContext(s State, fn func(ctx context.Context, subject Stater) error) {
+	defer m.lock()()
+
+	m.exit = addAction(m.exit, s, func(ctx context.Context, a *attempt) error {
+		return fn(ctx, a.subject)
+	})
+}
+
+// OnExitWith is like OnExit but the callback receives the transition arguments
+func (m *Machine) OnExitWith(s State, fn func(subject Stater, args any)) {
+	defer m.lock()()
+
+	m.exit = addAction(m.exit, s, func(_ context.Context, a *attempt) error {
+		fn(a.subject, a.args)
+		return nil
+	})
+}
+
+// OnTransition registers a callback fired after the subject successfully
+// moves from one exact state to another, once the enter callbacks of the
+// goal state have run.
+func (m *Machine) OnTransition(from, to State, fn func(subject Stater)) {
+	defer m.lock()()
+
+	if m.edges == nil {
+		m.edges = make(map[T][]action)
+	}
+	t := T{from, to}
+	m.edges[t] = append(m.edges[t], func(_ context.Context, a *attempt) error {
+		fn(a.subject)
+		return nil
+	})
+}
+
+// OnAnyTransition registers a callback fired after every successful
+// move, whatever the edge, once the enter callbacks and invariants have
+// run and before the observers are notified.
+func (m *Machine) OnAnyTransition(fn func(subject Stater, from, to State)) {
+	defer m.lock()()
+
+	m.moved = append(m.moved, fn)
+}
+
+// OnTransitionReason is like OnTransition but the callback also receives
+// the reason given to TransitionReason, which is empty for any other
+// transition.
+func (m *Machine) OnTransitionReason(from, to State, fn func(subject Stater, reason string)) {
+	defer m.lock()()
+
+	if m.edges == nil {
+		m.edges = make(map[T][]action)
+	}
+	t := T{from, to}
+	m.edges[t] = append(m.edges[t], func(_ context.Context, a *attempt) error {
+		fn(a.subject, a.reason)
+		return nil
+	})
+}
+
+// AddInvariant registers a check run after every successful SetState.
+// If it returns an error the transition is rolled back; see Transition.
+func (m *Machine) AddInvariant(fn func(subject Stater) error) {
+	defer m.lock()()
+
+	m.invariants = append(m.invariants, fn)
+}
+
+func addAction(actions map[State][]action, s State, fn action) map[State][]action {
+	if actions == nil {
+		actions = make(map[State][]action)
+	}
+	actions[s] = append(actions[s], fn)
+	return actions
+}
+
+// AddObserver registers a function notified after every Transition or
+// Fire attempt, in registration order. Firing an event that is not
+// defined for the current state is not an attempt and is not observed.
+func (m *Machine) AddObserver(fn func(from, to State, err error)) {
+	defer m.lock()()
+
+	m.observers = append(m.observers, fn)
+}
+
+// AddPreTransitionHook registers a check run before the guards of every
+// transition attempt, for operational gating that is not part of the
+// rules, such as a maintenance mode. An error aborts the attempt and is
+// returned as is; the OnReject callbacks are not run.
+func (m *Machine) AddPreTransitionHook(fn func(from, to State) error) {
+	defer m.lock()()
+
+	m.preHooks = append(m.preHooks, fn)
+}
+
+// AddReasonObserver is like AddObserver but the function also receives
+// the reason given to TransitionReason, which is empty for any other
+// transition. Reason observers are notified after the other observers.
+func (m *Machine) AddReasonObserver(fn func(from, to State, reason string, err error)) {
+	defer m.lock()()
+
+	m.reasonObservers = append(m.reasonObservers, fn)
+}
+
+// OnReject registers a callback fired once whenever a transition is
+// rejected because it is not permitted, however many guards failed.
+// Transitions abandoned because their context is done are not rejections.
+func (m *Machine) OnReject(fn func(from, to State)) {
+	defer m.lock()()
+
+	m.rejected = append(m.rejected, fn)
+}
+
+// Use appends middleware around every transition attempted by the
+// Machine; the first middleware added is the outermost. Middleware runs
+// while the Machine is locked; like a callback, it may call the Machine's
+// methods except those starting a transition, which fail with
+// ErrReentrantTransition.
+func (m *Machine) Use(mw ...Middleware) {
+	defer m.lock()()
+
+	m.middleware = append(m.middleware, mw...)
+}
+
+// SetCooldown requires d to pass after the subject last moved from one
+// state to another before that edge may be used again; attempts within d
+// fail with ErrCooldown before any guard runs. d <= 0 removes the cooldown.
+func (m *Machine) SetCooldown(from, to State, d time.Duration) {
+	defer m.lock()()
+
+	t := T{from, to}
+	if d <= 0 {
+		delete(m.cooldowns, t)
+		delete(m.lastUsed, t)
+		return
+	}
+	if m.cooldowns == nil {
+		m.cooldowns = make(map[T]time.Duration)
+		m.lastUsed = make(map[T]time.Time)
+	}
+	m.cooldowns[t] = d
+}
+
+// SetAutoTransition makes the Machine move on as soon as it enters from,
+// to the state decide returns; a negative state such as AnyState leaves
+// the subject in from. Guards apply as for any transition, and a failed
+// automatic transition is returned wrapped after the subject has
+// entered from. More than a fixed number of automatic transitions in a
+// row fails with ErrAutoTransitionLimit. A nil decide removes it.
+func (m *Machine) SetAutoTransition(from State, decide func(subject Stater) State) {
+	defer m.lock()()
+
+	if decide == nil {
+		delete(m.auto, from)
+		return
+	}
+	if m.auto == nil {
+		m.auto = make(map[State]func(subject Stater) State)
+	}
+	m.auto[from] = decide
+}
+
+// SetStrict sets whether transitions to a state that is not the exit of
+// any rule fail with ErrUnknownState rather than being rejected like any
+// other transition that is not allowed.
+func (m *Machine) SetStrict(strict bool) {
+	defer m.lock()()
+
+	m.strict = strict
+}
+
+// SetStateEqual sets how the Machine decides two states are equivalent:
+// when detecting transitions that would not change the effective state,
+// as TransitionIdempotent does, when a Prepare commit checks the subject
+// is still in the state it was prepared in, when TransitionPathAtomic
+// moves back through the states it passed, and when a state timeout
+// checks the subject is still in the timed state. The default, or a nil
+// fn, is ==.
+func (m *Machine) SetStateEqual(fn func(a, b State) bool) {
+	defer m.lock()()
+
+	m.stateEqual = fn
+}
+
+// equal compares states with the StateEqual function; m.mu must be held.
+func (m *Machine) equal(a, b State) bool {
+	if m.stateEqual == nil {
+		return a == b
+	}
+	return m.stateEqual(a, b)
+}
+
+// SetLogger sets a logger the Machine logs every successful transition to
+// at debug level and every failed attempt to at warn level, with the
+// reason. A nil logger, the default, disables logging.
+func (m *Machine) SetLogger(l *slog.Logger) {
+	defer m.lock()()
+
+	m.logger = l
+}
+
+// SetSequential sets whether the guards of a transition are run one at a
+// time in registration order, so the first failing guard is reported
+// deterministically. By default guards run in parallel.
+func (m *Machine) SetSequential(sequential bool) {
+	defer m.lock()()
+
+	m.options.sequential = sequential
+}
+
+// SetGuardTimeout fails any guard not returning within d with
+// ErrGuardTimeout; d <= 0 waits indefinitely, which is the default.
+func (m *Machine) SetGuardTimeout(d time.Duration) {
+	defer m.lock()()
+
+	m.options.timeout = d
+}
+
+// Transition attempts to move the Subject to the Goal state.
+// If a guard rejects the transition its error is returned, otherwise an
+// *InvalidTransitionError names the rejected transition. ErrTerminalState
+// is returned when the Subject is in a terminal state.
+//
+// Every transition attempt proceeds in this order, inside the middleware
+// registered with Use:
+//  1. the hooks added with AddPreTransitionHook, then the permit check,
+//     running the guards
+//  2. the exit callbacks of the origin state, in registration order
+//  3. SetState(goal)
+//  4. the enter callbacks of the goal state, in registration order
+//  5. the callbacks registered with OnTransition for the exact edge
+//  6. the invariants, in registration order
+//  7. the callbacks registered with OnAnyTransition
+//  8. the history entry, then the observers, in registration order
+//
+// If the permit check fails, the OnReject callbacks run and steps 2 to 7
+// are skipped. If an exit callback returns an error, the transition stops
+// before SetState with the error wrapped. If an enter callback or an
+// invariant returns an error the
+// remaining steps up to 7 are skipped, SetState(origin) rolls the subject
+// back, and the error is returned wrapped. Exit callbacks are not run
+// again, so a failed enter callback never leaves the subject in the goal
+// state. Step 8 always runs and sees the final error. Any automatic
+// transition set with SetAutoTransition follows a successful step 8.
+//
+// Once the outermost call has completed, including its automatic
+// transitions or every step of a path, the RuleSet's OnEnter callbacks
+// run for each state entered, in order, followed by starting its
+// OnEnterAsync callbacks and sending the event to subscribers. None of
+// them run for an attempt that was rolled back.
+func (m *Machine) Transition(goal State) error {
+	return m.TransitionContext(context.Background(), goal)
+}
+
+// MustTransition is like Transition but panics if the transition fails.
+// It is meant for setup code and tests whose transitions can't fail, and
+// is unsuitable for transitions driven by user input.
+func (m *Machine) MustTransition(goal State) {
+	if err := m.Transition(goal); err != nil {
+		panic(fmt.Sprintf("fsm: transition to %s failed: %v", goal, err))
+	}
+}
+
+// TransitionContext is like Transition but passes ctx down to the guards
+// and the callbacks registered with OnEnterContext and OnExitContext.
+// If ctx is done before the guards complete, ctx.Err() is returned.
+// The permit check and SetState happen atomically with respect to
+// other transitions on the same Machine.
+func (m *Machine) TransitionContext(ctx context.Context, goal State) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	return m.transition(ctx, goal, nil)
+}
+
+// TransitionWith is like Transition but passes args to the guards added
+// with AddRuleArgs and to the callbacks registered with OnEnterWith and
+// OnExitWith. Other guards and callbacks ignore args.
+func (m *Machine) TransitionWith(goal State, args any) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	return m.transition(context.Background(), goal, &request{args: args})
+}
+
+// TransitionReason is like Transition but records a human readable
+// reason for the transition, such as "cancelled by admin", in its history
+// entry and passes it to the callbacks registered with OnTransitionReason
+// and the observers added with AddReasonObserver.
+func (m *Machine) TransitionReason(goal State, reason string) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	return m.transition(context.Background(), goal, &request{reason: reason})
+}
+
+// TransitionResult is like Transition but returns the value produced by
+// the OnEnterResult callbacks of the goal state; with several, the last
+// to run wins. The value is nil if the transition fails.
+func (m *Machine) TransitionResult(goal State) (any, error) {
+	if err := m.begin(); err != nil {
+		return nil, err
+	}
+	defer m.end()
+
+	req := &request{}
+	err := m.transition(context.Background(), goal, req)
+	return req.result, err
+}
+
+// TransitionIdempotent is like Transition but returns nil without running
+// any guards or callbacks when the Subject is already in the goal state,
+// as compared by SetStateEqual.
+func (m *Machine) TransitionIdempotent(goal State) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	if m.equal(m.Subject.CurrentState(), goal) {
+		return nil
+	}
+	return m.transition(context.Background(), goal, nil)
+}
+
+// TransitionImmutable is like Transition for an ImmutableStater Subject:
+// rather than calling SetState, the Subject is replaced by the copy
+// WithState returns, which the enter callbacks and later steps receive.
+// The new Subject is returned, or the unchanged one if the transition
+// fails. ErrNotImmutable is returned for any other Subject.
+func (m *Machine) TransitionImmutable(goal State) (Stater, error) {
+	if err := m.begin(); err != nil {
+		return nil, err
+	}
+	defer m.end()
+
+	if _, ok := m.Subject.(ImmutableStater); !ok {
+		return m.Subject, ErrNotImmutable
+	}
+	err := m.transition(context.Background(), goal, &request{immutable: true})
+	return m.Subject, err
+}
+
+// TransitionRetry is like Transition but makes up to attempts tries (at
+// least one), waiting between them for backoff, doubled after every try.
+// The Machine is not locked while waiting. The error of the last try is
+// returned.
+func (m *Machine) TransitionRetry(goal State, attempts int, backoff time.Duration) error {
+	return m.TransitionRetryContext(context.Background(), goal, attempts, backoff)
+}
+
+// TransitionRetryContext is like TransitionRetry but stops retrying,
+// returning ctx.Err(), once ctx is done.
+func (m *Machine) TransitionRetryContext(ctx context.Context, goal State, attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		if err = m.TransitionContext(ctx, goal); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// TransitionAsync performs Transition in a new goroutine and sends its
+// result on the returned channel exactly once. Like any other transition
+// it is serialized with the Machine's other transitions.
+func (m *Machine) TransitionAsync(goal State) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- m.Transition(goal)
+	}()
+	return result
+}
+
+// PathError reports the step of a TransitionPath that failed
+type PathError struct {
+	Index int   // Index of the failing state in the path
+	Goal  State // Goal is the state at Index
+	Err   error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("path step %d to %s: %v", e.Index, e.Goal, e.Err)
+}
+
+// Unwrap returns the error of the failing transition
+func (e *PathError) Unwrap() error { return e.Err }
+
+// TransitionPath moves the Subject through each of the states in order,
+// stopping at the first failure with a *PathError. No other transition
+// on the Machine is interleaved with the path.
+func (m *Machine) TransitionPath(states ...State) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	for i, goal := range states {
+		if err := m.transition(context.Background(), goal, nil); err != nil {
+			return &PathError{Index: i, Goal: goal, Err: err}
+		}
+	}
+	return nil
+}
+
+// TransitionPathAtomic is like TransitionPath but if any step fails the
+// subject is moved back through each state it passed, most recent first,
+// to the state it had before the path started. Moving back runs the exit
+// and enter callbacks and records history as Reset does, so the caller
+// sees either every step or no net change. Neither the RuleSet's OnEnter
+// nor the OnEnterAsync callbacks run for a path that was moved back, and
+// subscribers receive no events for it.
+func (m *Machine) TransitionPathAtomic(states ...State) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	visited := []State{m.Subject.CurrentState()}
+	for i, goal := range states {
+		if err := m.transition(context.Background(), goal, nil); err != nil {
+			for j := len(visited) - 1; j >= 0; j-- {
+				if !m.equal(m.Subject.CurrentState(), visited[j]) {
+					m.reset(visited[j])
+				}
+			}
+			m.effects = nil
+			return &PathError{Index: i, Goal: goal, Err: err}
+		}
+		visited = append(visited, m.Subject.CurrentState())
+	}
+	return nil
+}
+
+// OnPrepare registers a callback run by Prepare for the goal state, once
+// the transition is known to be permitted. An error fails the Prepare.
+func (m *Machine) OnPrepare(s State, fn func(subject Stater) error) {
+	defer m.lock()()
+
+	m.prepare = addAction(m.prepare, s, func(_ context.Context, a *attempt) error {
+		return fn(a.subject)
+	})
+}
+
+// Prepare is the first phase of a two phase transition, for coordinating
+// a transition with an external transaction. It checks the Subject may
+// move to the goal state and runs the OnPrepare callbacks of the goal
+// without changing the state.
+//
+// Calling commit then moves the Subject as Transition does from its
+// exit callbacks on, without running the guards or middleware again.
+// It fails with ErrStalePrepare if the Subject has since left the state
+// it was prepared in, or if commit or abort was already called.
+// Calling abort discards the prepared transition.
+//
+// The Machine is not locked between the phases, so other transitions may
+// happen meanwhile. If neither commit nor abort is called the prepared
+// transition is never applied; nothing is held or leaked.
+func (m *Machine) Prepare(goal State) (commit func() error, abort func(), err error) {
+	if err := m.begin(); err != nil {
+		return nil, nil, err
+	}
+	defer m.end()
+
+	ctx := withScratchpad(context.Background())
+	a := newAttempt(m.Subject, goal)
+	if err := m.permit(ctx, a); err != nil {
+		return nil, nil, err
+	}
+	for _, fn := range m.prepare[goal] {
+		if err := fn(ctx, a); err != nil {
+			return nil, nil, fmt.Errorf("preparing %s: %w", goal, err)
+		}
+	}
+
+	done := false // guarded by m.mu
+	commit = func() error {
+		if err := m.begin(); err != nil {
+			return err
+		}
+		defer m.end()
+
+		if done || !m.equal(m.Subject.CurrentState(), a.origin) {
+			return ErrStalePrepare
+		}
+		done = true
+		a.subject = m.Subject
+		a.origin = m.Subject.CurrentState()
+
+		err := m.move(ctx, a)
+		m.record(ctx, a, err)
+		if err != nil {
+			return err
+		}
+		return m.follow(ctx, false)
+	}
+	abort = func() {
+		defer m.lock()()
+
+		done = true
+	}
+	return commit, abort, nil
+}
+
+// Fire performs the transition defined for the named event from the
+// Subject's current state. ErrNoSuchEvent is returned when the event is
+// not defined for the current state.
+func (m *Machine) Fire(event string) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	e, ok := m.Rules.event(m.Subject.CurrentState(), event)
+	if !ok {
+		return ErrNoSuchEvent
+	}
+	return m.transition(context.Background(), e.To, nil)
+}
+
+// Reset forces the Subject into the initial state without running any
+// guards, for use in tests and replays rather than business logic.
+// The exit callbacks of the current state and the enter callbacks of the
+// initial state run as for a transition, but errors from callbacks are
+// ignored and never stop or roll back the reset. Observers are not notified;
+// the history records the reset with HistoryEntry.Reset set. Called from a
+// callback of a transition the reset happens at once, within that
+// transition.
+func (m *Machine) Reset(initial State) {
+	defer m.lock()()
+
+	m.reset(initial)
+}
+
+// reset does the work of Reset; m.mu must be held.
+func (m *Machine) reset(initial State) {
+	a := newAttempt(m.Subject, initial)
+	ctx := context.Background()
+	for _, fn := range m.exit[a.origin] {
+		fn(ctx, a)
+	}
+	a.subject.SetState(initial)
+	if timed, ok := a.subject.(TimedStater); ok {
+		timed.SetStateEnteredAt(time.Now())
+	}
+	for _, fn := range m.enter[initial] {
+		fn(ctx, a)
+	}
+	subject := a.subject
+	m.effects = append(m.effects, func() { m.Rules.enter(subject, initial) })
+	if m.timer != nil || len(m.timeouts) > 0 {
+		m.arm(initial)
+	}
+	m.history.record(HistoryEntry{From: a.origin, To: initial, Reset: true})
+}
+
+// request holds the inputs and outputs of a single call transitioning
+// the Machine, which may make several attempts through middleware.
+type request struct {
+	args      any
+	result    any
+	immutable bool
+	reason    string
+}
+
+// transition does the work of TransitionContext through the middleware
+// chain; m.mu must be held. req may be nil.
+func (m *Machine) transition(ctx context.Context, goal State, req *request) error {
+	if req == nil {
+		req = &request{}
+	}
+
+	if err := m.chain(ctx, req)(goal); err != nil {
+		return err
+	}
+	return m.follow(ctx, req.immutable)
+}
+
+// chain returns the middleware wrapped TransitionFunc performing req
+func (m *Machine) chain(ctx context.Context, req *request) TransitionFunc {
+	next := func(goal State) error {
+		return m.perform(ctx, goal, req)
+	}
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		next = m.middleware[i](next)
+	}
+	return next
+}
+
+// follow performs the automatic transitions out of the state just
+// entered; m.mu must be held.
+func (m *Machine) follow(ctx context.Context, immutable bool) error {
+	for n := 0; ; n++ {
+		decide, ok := m.auto[m.Subject.CurrentState()]
+		if !ok {
+			return nil
+		}
+		goal := decide(m.Subject)
+		if goal < 0 {
+			return nil
+		}
+		if n == maxAutoTransitions {
+			return ErrAutoTransitionLimit
+		}
+		if err := m.chain(ctx, &request{immutable: immutable})(goal); err != nil {
+			return fmt.Errorf("auto transition to %s: %w", goal, err)
+		}
+	}
+}
+
+// perform attempts the transition, recording the outcome and notifying
+// observers.
+func (m *Machine) perform(ctx context.Context, goal State, req *request) error {
+	ctx = withScratchpad(ctx)
+	a := newAttempt(m.Subject, goal)
+	a.args = req.args
+	a.immutable = req.immutable
+	a.reason = req.reason
+
+	err := m.apply(ctx, a)
+	if err == nil {
+		req.result = a.result
+	}
+
+	m.record(ctx, a, err)
+	return err
+}
+
+// record adds the outcome of the attempt to the history and statistics
+// and notifies the logger and observers.
+func (m *Machine) record(ctx context.Context, a *attempt, err error) {
+	m.history.record(HistoryEntry{From: a.origin, To: a.goal, Err: err, Reason: a.reason})
+	m.stats.record(a.origin, a.goal, err)
+	if m.logger != nil {
+		from, to := slog.String("from", a.origin.String()), slog.String("to", a.goal.String())
+		if err == nil {
+			m.logger.LogAttrs(ctx, slog.LevelDebug, "fsm transition", from, to)
+		} else {
+			m.logger.LogAttrs(ctx, slog.LevelWarn, "fsm transition rejected", from, to, slog.String("reason", err.Error()))
+		}
+	}
+	for _, fn := range m.observers {
+		fn(a.origin, a.goal, err)
+	}
+	for _, fn := range m.reasonObservers {
+		fn(a.origin, a.goal, a.reason, err)
+	}
+	if err == nil && len(m.subscribers) > 0 {
+		e := TransitionEvent{From: a.origin, To: a.goal, Time: time.Now()}
+		m.effects = append(m.effects, func() { m.publish(e) })
+	}
+}
+
+// apply checks the guards and moves the Subject from the origin to the
+// goal of the attempt, running the exit and enter callbacks.
+func (m *Machine) apply(ctx context.Context, a *attempt) error {
+	if err := m.permit(ctx, a); err != nil {
+		return err
+	}
+	return m.move(ctx, a)
+}
+
+// permit checks whether the attempt may proceed, running the
+// pre-transition hooks and the guards.
+func (m *Machine) permit(ctx context.Context, a *attempt) error {
+	if err := m.precheck(a); err != nil {
+		return err
+	}
+
+	if err := m.Rules.evaluate(ctx, a, m.options); err != nil {
+		if err == ErrInvalidTransition {
+			err = &InvalidTransitionError{From: a.origin, To: a.goal}
+		}
+		if ctx.Err() == nil {
+			m.rejections.record(a.origin, a.goal, err)
+			for _, fn := range m.rejected {
+				fn(a.origin, a.goal)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// precheck runs the checks an attempt must pass before its guards run:
+// strict mode, disabled edges, cooldowns and the pre-transition hooks.
+func (m *Machine) precheck(a *attempt) error {
+	if m.strict && !m.Rules.hasExit(a.goal) {
+		return ErrUnknownState
+	}
+
+	edge := T{a.origin, a.goal}
+	if m.disabled[edge] {
+		return ErrTransitionDisabled
+	}
+
+	cooldown, cooling := m.cooldowns[edge]
+	if cooling && time.Since(m.lastUsed[edge]) < cooldown {
+		return ErrCooldown
+	}
+
+	for _, fn := range m.preHooks {
+		if err := fn(a.origin, a.goal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowed reports whether an attempt would be permitted, without the
+// rejection bookkeeping and OnReject callbacks of permit.
+func (m *Machine) allowed(a *attempt) bool {
+	return m.precheck(a) == nil && m.Rules.evaluate(context.Background(), a, m.options) == nil
+}
+
+// stepError is the error of a callback or invariant that stopped an
+// attempt while leaving or entering state.
+type stepError struct {
+	step  string
+	state State
+	err   error
+}
+
+func (e *stepError) Error() string { return fmt.Sprintf("%s %s: %v", e.step, e.state, e.err) }
+
+func (e *stepError) Unwrap() error { return e.err }
+
+// move runs the callbacks of a permitted attempt around SetState, rolling
+// back on failure.
+func (m *Machine) move(ctx context.Context, a *attempt) error {
+	edge := T{a.origin, a.goal}
+	for _, fn := range m.exit[a.origin] {
+		if err := fn(ctx, a); err != nil {
+			return &stepError{step: "exiting", state: a.origin, err: err}
+		}
+	}
+	m.setState(a)
+	for _, fn := range m.enter[a.goal] {
+		if err := fn(ctx, a); err != nil {
+			m.rollback(a)
+			return &stepError{step: "entering", state: a.goal, err: err}
+		}
+	}
+	for _, fn := range m.edges[edge] {
+		fn(ctx, a)
+	}
+	for _, fn := range m.invariants {
+		if err := fn(a.subject); err != nil {
+			m.rollback(a)
+			return &stepError{step: "invariant violated entering", state: a.goal, err: err}
+		}
+	}
+	if timed, ok := a.subject.(TimedStater); ok {
+		timed.SetStateEnteredAt(time.Now())
+	}
+	for _, fn := range m.moved {
+		fn(a.subject, a.origin, a.goal)
+	}
+	if _, cooling := m.cooldowns[edge]; cooling {
+		m.lastUsed[edge] = time.Now()
+	}
+	if m.timer != nil || len(m.timeouts) > 0 {
+		m.arm(a.goal)
+	}
+	subject, goal := a.subject, a.goal
+	m.effects = append(m.effects, func() {
+		m.Rules.enter(subject, goal)
+		m.enterAsync(subject, goal)
+	})
+	return nil
+}
+
+// setState moves the attempt's subject to the goal. An immutable subject
+// is replaced by a copy in the goal state, which becomes the Subject.
+func (m *Machine) setState(a *attempt) {
+	immutable, ok := a.subject.(ImmutableStater)
+	if !a.immutable || !ok {
+		a.immutable = false
+		a.subject.SetState(a.goal)
+		return
+	}
+	a.original = a.subject
+	a.subject = immutable.WithState(a.goal)
+	m.Subject = a.subject
+}
+
+// rollback undoes setState
+func (m *Machine) rollback(a *attempt) {
+	if !a.immutable {
+		a.subject.SetState(a.origin)
+		return
+	}
+	a.subject = a.original
+	m.Subject = a.original
+}
+
+// CanTransition reports whether the Subject is permitted to move to the
+// goal state, without moving it or running any callbacks or observers.
+// It applies the same checks as Transition: strict mode, disabled edges,
+// cooldowns, the pre-transition hooks and the guards.
+func (m *Machine) CanTransition(goal State) bool {
+	defer m.lock()()
+
+	return m.allowed(newAttempt(m.Subject, goal))
+}
+
+// IsTerminal reports whether the Subject is in a terminal state
+func (m *Machine) IsTerminal() bool {
+	defer m.lock()()
+
+	return m.Rules.IsTerminal(m.Subject.CurrentState())
+}
+
+// AvailableTransitions returns the states the Subject is currently
+// permitted to move to, checking every candidate rule as CanTransition
+// does.
+func (m *Machine) AvailableTransitions() []State {
+	defer m.lock()()
+
+	var available []State
+	for _, goal := range m.Rules.goals(m.Subject.CurrentState()) {
+		if m.allowed(newAttempt(m.Subject, goal)) {
+			available = append(available, goal)
+		}
+	}
+	return available
+}
+
+// PossibleTransitions returns the states reachable from the Subject's
+// current state by rule structure alone; guards are not run.
+func (m *Machine) PossibleTransitions() []State {
+	defer m.lock()()
+
+	return m.Rules.goals(m.Subject.CurrentState())
+}
+
+// New initializes a machine
+func New(rules *RuleSet, subject Stater) *Machine {
+	m := &Machine{
+		Rules:   rules,
+		Subject: subject,
+	}
+	return m
+}
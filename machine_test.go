@@ -0,0 +1,285 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAvailableTransitionsUsesGuardTimeout(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{0, 2})
+	r.AddRule(T{0, 2}, func(Stater, State) bool {
+		time.Sleep(200 * time.Millisecond)
+		return true
+	})
+	m := New(&r, &thing{})
+	m.SetGuardTimeout(10 * time.Millisecond)
+
+	available := m.AvailableTransitions()
+	if len(available) != 1 || available[0] != 1 {
+		t.Fatalf("AvailableTransitions() = %v, want [1]", available)
+	}
+	if m.CanTransition(2) {
+		t.Fatal("CanTransition(2) ignored the guard timeout")
+	}
+}
+
+func TestQueriesAgreeWithTransition(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 0}, T{0, 2})
+	m := New(&r, &thing{})
+	m.SetCooldown(0, 1, time.Hour)
+	m.SetStrict(true)
+
+	if !m.CanTransition(1) {
+		t.Fatal("CanTransition(1) before the edge was used")
+	}
+	if err := m.Transition(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Transition(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Transition(1); err != ErrCooldown {
+		t.Fatalf("Transition(1) = %v, want ErrCooldown", err)
+	}
+	if m.CanTransition(1) {
+		t.Fatal("CanTransition(1) ignored the cooldown")
+	}
+	if available := m.AvailableTransitions(); len(available) != 1 || available[0] != 2 {
+		t.Fatalf("AvailableTransitions() = %v, want [2]", available)
+	}
+
+	if err := m.Transition(7); err != ErrUnknownState {
+		t.Fatalf("Transition(7) = %v, want ErrUnknownState", err)
+	}
+	if m.CanTransition(7) {
+		t.Fatal("CanTransition(7) ignored strict mode")
+	}
+}
+
+// sameDigit treats states as equivalent when their last digits match
+func sameDigit(a, b State) bool { return a%10 == b%10 }
+
+func TestPrepareUsesStateEqual(t *testing.T) {
+	r := CreateRuleSet(T{0, 1})
+	th := &thing{}
+	m := New(&r, th)
+	m.SetStateEqual(sameDigit)
+
+	commit, _, err := m.Prepare(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Reset(10)
+	if err := commit(); err != nil {
+		t.Fatalf("commit after moving to an equivalent state: %v", err)
+	}
+	if th.s != 1 {
+		t.Fatalf("state = %v, want 1", th.s)
+	}
+}
+
+func TestStateTimeoutUsesStateEqual(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2}, T{11, 2})
+	s := NewSafeState(0)
+	m := New(&r, s)
+	m.SetStateEqual(sameDigit)
+	m.SetStateTimeout(1, 20*time.Millisecond, 2)
+
+	if err := m.Transition(1); err != nil {
+		t.Fatal(err)
+	}
+	s.SetState(11)
+
+	deadline := time.Now().Add(time.Second)
+	for s.CurrentState() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %v, the timeout didn't fire in an equivalent state", s.CurrentState())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRuleSetOnEnterSkipsRolledBackPath(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2})
+	r.AddRuleE(T{1, 2}, func(Stater, State) error { return errors.New("closed") })
+	entered := 0
+	r.OnEnter(1, func(Stater) { entered++ })
+	m := New(&r, &thing{})
+
+	if err := m.TransitionPathAtomic(1, 2); err == nil {
+		t.Fatal("expected the path to fail")
+	}
+	if entered != 0 {
+		t.Fatalf("OnEnter ran %d times for a rolled back path", entered)
+	}
+
+	if err := m.TransitionPath(1, 2); err == nil {
+		t.Fatal("expected the path to fail")
+	}
+	if entered != 1 {
+		t.Fatalf("OnEnter ran %d times for the committed step, want 1", entered)
+	}
+}
+
+// recorder is a subject logging every SetState
+type recorder struct {
+	s   State
+	log *[]string
+}
+
+func (r *recorder) CurrentState() State { return r.s }
+func (r *recorder) SetState(s State) {
+	*r.log = append(*r.log, fmt.Sprintf("SetState(%d)", s))
+	r.s = s
+}
+
+func TestTransitionOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		deny      bool
+		failEnter bool
+		failCheck bool
+		want      []string
+	}{
+		{
+			name: "success",
+			want: []string{"hook", "guard", "exit", "SetState(1)", "enter", "edge", "invariant",
+				"any", "observer", "rules enter"},
+		},
+		{
+			name: "guard rejects",
+			deny: true,
+			want: []string{"hook", "guard", "reject", "observer failed"},
+		},
+		{
+			name:      "enter callback fails",
+			failEnter: true,
+			want:      []string{"hook", "guard", "exit", "SetState(1)", "enter", "SetState(0)", "observer failed"},
+		},
+		{
+			name:      "invariant fails",
+			failCheck: true,
+			want: []string{"hook", "guard", "exit", "SetState(1)", "enter", "edge", "invariant",
+				"SetState(0)", "observer failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log []string
+			note := func(s string) { log = append(log, s) }
+			fail := func(failed bool) error {
+				if failed {
+					return errors.New("failed")
+				}
+				return nil
+			}
+
+			r := CreateRuleSet(T{0, 1})
+			r.AddRule(T{0, 1}, func(Stater, State) bool {
+				note("guard")
+				return !tt.deny
+			})
+			r.OnEnter(1, func(Stater) { note("rules enter") })
+
+			subject := &recorder{log: &log}
+			m := New(&r, subject)
+			m.AddPreTransitionHook(func(State, State) error {
+				note("hook")
+				return nil
+			})
+			m.OnReject(func(State, State) { note("reject") })
+			m.OnExit(0, func(Stater) { note("exit") })
+			m.OnEnterE(1, func(Stater) error {
+				note("enter")
+				return fail(tt.failEnter)
+			})
+			m.OnTransition(0, 1, func(Stater) { note("edge") })
+			m.AddInvariant(func(Stater) error {
+				note("invariant")
+				return fail(tt.failCheck)
+			})
+			m.OnAnyTransition(func(Stater, State, State) { note("any") })
+			m.AddObserver(func(from, to State, err error) {
+				if err != nil {
+					note("observer failed")
+				} else {
+					note("observer")
+				}
+			})
+
+			err := m.Transition(1)
+			if failed := tt.deny || tt.failEnter || tt.failCheck; failed != (err != nil) {
+				t.Fatalf("Transition(1) = %v", err)
+			}
+			want := State(1)
+			if err != nil {
+				want = 0
+			}
+			if subject.s != want {
+				t.Fatalf("state = %v after Transition(1) = %v, want %v", subject.s, err, want)
+			}
+			if strings.Join(log, ", ") != strings.Join(tt.want, ", ") {
+				t.Fatalf("calls\n  %s\nwant\n  %s", strings.Join(log, ", "), strings.Join(tt.want, ", "))
+			}
+		})
+	}
+}
+
+func TestConcurrentTransitions(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2}, T{2, 0})
+	th := &thing{}
+	m := New(&r, th)
+
+	var succeeded atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if m.Transition(State((i+j)%3)) == nil {
+					succeeded.Add(1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// every successful transition moves one step around the cycle
+	if want := State(succeeded.Load() % 3); th.s != want {
+		t.Fatalf("state = %v after %d transitions, want %v", th.s, succeeded.Load(), want)
+	}
+}
+
+func TestSequentialGuardsHonourContext(t *testing.T) {
+	r := CreateRuleSet(T{0, 1})
+	r.AddRule(T{0, 1}, func(Stater, State) bool {
+		time.Sleep(300 * time.Millisecond)
+		return true
+	})
+
+	for _, timeout := range []time.Duration{0, time.Second} {
+		m := New(&r, &thing{})
+		m.SetSequential(true)
+		m.SetGuardTimeout(timeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		start := time.Now()
+		err := m.TransitionContext(ctx, 1)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("guard timeout %v: TransitionContext = %v, want context.DeadlineExceeded", timeout, err)
+		}
+		if d := time.Since(start); d > 150*time.Millisecond {
+			t.Fatalf("guard timeout %v: TransitionContext took %v waiting for the guard", timeout, d)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMergeConflict the rule sets being merged disagree
+var ErrMergeConflict = errors.New("merge conflict")
+
+// Merge folds the transitions, guards and events of other into the rule
+// set. Guards of edges present in both are appended after the receiver's
+// own. Nothing is merged if the rule sets conflict: when their start
+// states, event goals, parents or priorities differ, or when a state is
+// terminal in one but has outgoing transitions in the other; every
+// conflict is reported wrapping ErrMergeConflict.
+func (r *RuleSet) Merge(other RuleSet) error {
+	r.mutable()
+	if err := r.conflicts(&other); err != nil {
+		return err
+	}
+
+	for t, guards := range other.rules {
+		if r.rules == nil {
+			r.rules = make(map[Transition][]guard)
+		}
+		r.rules[t] = append(r.rules[t], guards...)
+	}
+	r.global = append(r.global, other.global...)
+
+	for _, e := range other.events {
+		r.addEvent(e)
+	}
+	for child, parent := range other.parents {
+		r.SetParent(child, parent)
+	}
+	for t, p := range other.priorities {
+		if r.priorities == nil {
+			r.priorities = make(map[Transition]int)
+		}
+		r.priorities[t] = p
+	}
+	for s := range other.terminals {
+		r.MarkTerminal(s)
+	}
+	for group, states := range other.groups {
+		r.Tag(group, states...)
+	}
+	for s, fns := range other.entered {
+		for _, fn := range fns {
+			r.OnEnter(s, fn)
+		}
+	}
+
+	if other.hasStart {
+		r.SetStart(other.start)
+	}
+	if r.tracer == nil {
+		r.tracer = other.tracer
+	}
+	return nil
+}
+
+// conflicts returns every reason other can't be merged into the rule set
+func (r *RuleSet) conflicts(other *RuleSet) error {
+	var errs []error
+
+	if r.hasStart && other.hasStart && r.start != other.start {
+		errs = append(errs, fmt.Errorf("%w: start %s and %s", ErrMergeConflict, r.start, other.start))
+	}
+	for k, e := range other.events {
+		if mine, ok := r.events[k]; ok && mine.To != e.To {
+			errs = append(errs, fmt.Errorf("%w: event %q from %s to %s and %s", ErrMergeConflict, e.Name, e.From, mine.To, e.To))
+		}
+	}
+	for child, parent := range other.parents {
+		if mine, ok := r.parents[child]; ok && mine != parent {
+			errs = append(errs, fmt.Errorf("%w: parent of %s is %s and %s", ErrMergeConflict, child, mine, parent))
+		}
+	}
+	for t, p := range other.priorities {
+		if mine, ok := r.priorities[t]; ok && mine != p {
+			errs = append(errs, fmt.Errorf("%w: priority of %s -> %s is %d and %d", ErrMergeConflict, t.Origin(), t.Exit(), mine, p))
+		}
+	}
+	for s := range other.terminals {
+		if !r.terminals[s] && r.hasOutgoing(s) {
+			errs = append(errs, fmt.Errorf("%w: %s is terminal but has transitions", ErrMergeConflict, s))
+		}
+	}
+	for s := range r.terminals {
+		if !other.terminals[s] && other.hasOutgoing(s) {
+			errs = append(errs, fmt.Errorf("%w: %s is terminal but has transitions", ErrMergeConflict, s))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// hasOutgoing reports whether any rule starts from s itself
+func (r *RuleSet) hasOutgoing(s State) bool {
+	for t := range r.rules {
+		if t.Origin() == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package fsm
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// begin locks the Machine for a transition, failing with
+// ErrReentrantTransition instead of deadlocking when the calling
+// goroutine already holds it, as a callback of a transition or of Reset
+// does.
+func (m *Machine) begin() error {
+	id := goroutineID()
+	if m.owner.Load() == id {
+		return ErrReentrantTransition
+	}
+
+	m.mu.Lock()
+	m.owner.Store(id)
+	m.transitioning.Store(true)
+	return nil
+}
+
+// end runs the effects deferred by the operation and unlocks the Machine
+// after begin or lock.
+func (m *Machine) end() {
+	m.flush()
+	m.transitioning.Store(false)
+	m.owner.Store(0)
+	m.mu.Unlock()
+}
+
+// lock locks the Machine for any call other than a transition and returns
+// the function unlocking it. When the calling goroutine already holds the
+// lock, as a callback of a transition does, the call runs as part of that
+// operation and nothing is locked again.
+func (m *Machine) lock() (unlock func()) {
+	id := goroutineID()
+	if m.owner.Load() == id {
+		return func() {}
+	}
+
+	m.mu.Lock()
+	m.owner.Store(id)
+	return m.end
+}
+
+// Transitioning reports whether a transition is in progress, as it is
+// while any callback or middleware of the transition runs.
+func (m *Machine) Transitioning() bool {
+	return m.transitioning.Load()
+}
+
+// goroutineID returns the id of the calling goroutine, parsed from the
+// "goroutine N [...]" header of its stack trace.
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,165 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+// withinCallback runs fn from an enter callback of a transition to 1 and
+// fails the test if the transition deadlocks.
+func withinCallback(t *testing.T, m *Machine, fn func()) {
+	t.Helper()
+	m.OnEnter(1, func(Stater) { fn() })
+
+	done := make(chan error, 1)
+	go func() { done <- m.Transition(1) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlocked calling the Machine from a callback")
+	}
+}
+
+func TestCallbackCallsMachine(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2})
+
+	t.Run("Transition", func(t *testing.T) {
+		m := New(&r, &thing{})
+		var err error
+		withinCallback(t, m, func() { err = m.Transition(2) })
+		if err != ErrReentrantTransition {
+			t.Fatalf("Transition from a callback = %v, want ErrReentrantTransition", err)
+		}
+	})
+
+	t.Run("Transitioning", func(t *testing.T) {
+		m := New(&r, &thing{})
+		var during bool
+		withinCallback(t, m, func() { during = m.Transitioning() })
+		if !during || m.Transitioning() {
+			t.Fatal("Transitioning didn't report the transition in progress")
+		}
+	})
+
+	t.Run("CanTransition", func(t *testing.T) {
+		m := New(&r, &thing{})
+		var can bool
+		withinCallback(t, m, func() { can = m.CanTransition(2) })
+		if !can {
+			t.Fatal("CanTransition(2) from the enter callback of 1")
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		m := New(&r, &thing{})
+		m.EnableHistory()
+		var n int
+		withinCallback(t, m, func() { n = len(m.History()) })
+		if n != 0 || len(m.History()) != 1 {
+			t.Fatalf("history has %d entries during the transition, %d after", n, len(m.History()))
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		m := New(&r, &thing{})
+		withinCallback(t, m, func() { m.Stats() })
+		if s := m.Stats(); s.Succeeded != 1 {
+			t.Fatalf("Stats().Succeeded = %d, want 1", s.Succeeded)
+		}
+	})
+
+	t.Run("SetSubject", func(t *testing.T) {
+		m := New(&r, &thing{})
+		next := &thing{s: 1}
+		withinCallback(t, m, func() { m.SetSubject(next) })
+		if m.Subject != next {
+			t.Fatal("SetSubject from a callback was lost")
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		th := &thing{}
+		m := New(&r, th)
+		m.AddObserver(func(from, to State, err error) {
+			if err == nil && to == 1 {
+				m.Reset(0)
+			}
+		})
+		withinCallback(t, m, func() {})
+		if th.s != 0 {
+			t.Fatalf("state = %v after Reset from an observer, want 0", th.s)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		m := New(&r, &thing{})
+		commit, abort, err := m.Prepare(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		withinCallback(t, m, abort)
+		m.Reset(0)
+		if err := commit(); err != ErrStalePrepare {
+			t.Fatalf("commit after abort = %v, want ErrStalePrepare", err)
+		}
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		m := New(&r, &thing{})
+		events, unsubscribe := m.Subscribe()
+		m.AddObserver(func(State, State, error) { unsubscribe() })
+		withinCallback(t, m, func() {})
+		if _, ok := <-events; ok {
+			t.Fatal("event published after unsubscribing")
+		}
+	})
+}
+
+func TestMiddlewareCallsMachine(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2})
+	m := New(&r, &thing{})
+	m.EnableHistory()
+	var nested error
+	m.Use(func(next TransitionFunc) TransitionFunc {
+		return func(goal State) error {
+			m.History()
+			nested = m.Transition(2)
+			return next(goal)
+		}
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Transition(1) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlocked calling the Machine from middleware")
+	}
+	if nested != ErrReentrantTransition {
+		t.Fatalf("Transition from middleware = %v, want ErrReentrantTransition", nested)
+	}
+}
+
+func TestSequentialGuardCallsMachine(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2})
+	m := New(&r, &thing{})
+	m.SetSequential(true)
+	var nested error
+	r.AddRule(T{0, 1}, func(Stater, State) bool {
+		nested = m.Transition(2)
+		return true
+	})
+
+	if err := m.Transition(1); err != nil {
+		t.Fatal(err)
+	}
+	if nested != ErrReentrantTransition {
+		t.Fatalf("Transition from a sequential guard = %v, want ErrReentrantTransition", nested)
+	}
+}
@@ -0,0 +1,64 @@
+package fsm
+
+import (
+	"errors"
+	"time"
+)
+
+// Rejection records a transition attempt that was not permitted
+type Rejection struct {
+	From, To State
+	Time     time.Time
+
+	// Guard is the name of the guard that blocked the transition, if known
+	Guard string
+	Err   error
+}
+
+// rejections is a ring buffer of the most recent rejections
+type rejections struct {
+	entries []Rejection
+	next    int  // next is the index the next rejection is written to
+	full    bool // full is set once the buffer has wrapped
+}
+
+func (r *rejections) record(from, to State, err error) {
+	if len(r.entries) == 0 {
+		return
+	}
+
+	rejection := Rejection{From: from, To: to, Time: time.Now(), Err: err}
+	var invalid *InvalidTransitionError
+	if errors.As(err, &invalid) {
+		rejection.Guard = invalid.Guard
+	}
+
+	r.entries[r.next] = rejection
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// KeepRejections keeps the last n rejected transitions for
+// RecentRejections, discarding any kept so far; n <= 0 keeps none, which
+// is the default.
+func (m *Machine) KeepRejections(n int) {
+	defer m.lock()()
+
+	m.rejections = rejections{}
+	if n > 0 {
+		m.rejections.entries = make([]Rejection, n)
+	}
+}
+
+// RecentRejections returns a copy of the kept rejections, oldest first
+func (m *Machine) RecentRejections() []Rejection {
+	defer m.lock()()
+
+	r := &m.rejections
+	if !r.full {
+		return append([]Rejection(nil), r.entries[:r.next]...)
+	}
+	return append(append([]Rejection(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
@@ -0,0 +1,58 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHistoryMismatch the history entry does not start where the previous
+// one ended
+var ErrHistoryMismatch = errors.New("history mismatch")
+
+// Replay reconstructs the state reached by applying each history entry in
+// order from start, checking every transition exists in the rule set,
+// ignoring guards. Failed attempts are skipped and resets move straight
+// to their state. It stops at the first inconsistent entry, returning
+// the state reached so far and an error naming the entry.
+func (r *RuleSet) Replay(start State, history []HistoryEntry) (State, error) {
+	return r.replay(start, history, func(s State, e HistoryEntry) error {
+		if r.terminals[s] {
+			return ErrTerminalState
+		}
+		if !containsState(r.goals(s), e.To) {
+			return &InvalidTransitionError{From: e.From, To: e.To}
+		}
+		return nil
+	})
+}
+
+// ReplayGuarded is like Replay but also runs the guards of every
+// transition against a SafeState in the replayed state. Guards depending
+// on anything but the state may reject transitions that were permitted
+// at the time.
+func (r *RuleSet) ReplayGuarded(start State, history []HistoryEntry) (State, error) {
+	return r.replay(start, history, func(s State, e HistoryEntry) error {
+		return r.PermittedE(NewSafeState(s), e.To)
+	})
+}
+
+func (r *RuleSet) replay(start State, history []HistoryEntry, check func(s State, e HistoryEntry) error) (State, error) {
+	s := start
+	for i, e := range history {
+		switch {
+		case e.Reset:
+			s = e.To
+			continue
+		case e.Err != nil:
+			continue
+		case e.From != s:
+			return s, fmt.Errorf("history entry %d: %w: from %s, expected %s", i, ErrHistoryMismatch, e.From, s)
+		}
+
+		if err := check(s, e); err != nil {
+			return s, fmt.Errorf("history entry %d: %w", i, err)
+		}
+		s = e.To
+	}
+	return s, nil
+}
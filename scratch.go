@@ -0,0 +1,57 @@
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// Scratchpad holds values shared by the guards and callbacks of a single
+// transition attempt, such as an expensive score a guard computed that an
+// enter callback needs. It is discarded once the attempt completes.
+// It is safe for concurrent use by guards running in parallel.
+type Scratchpad struct {
+	mu     sync.Mutex
+	values map[any]any
+}
+
+type scratchpadKey struct{}
+
+// ScratchpadFrom returns the Scratchpad of the transition attempt ctx
+// belongs to, as passed to a ContextGuard or an OnEnterContext or
+// OnExitContext callback by a Machine. It returns nil outside a Machine
+// transition; a nil Scratchpad holds nothing and ignores Set.
+func ScratchpadFrom(ctx context.Context) *Scratchpad {
+	s, _ := ctx.Value(scratchpadKey{}).(*Scratchpad)
+	return s
+}
+
+// withScratchpad returns ctx carrying a new Scratchpad
+func withScratchpad(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scratchpadKey{}, &Scratchpad{})
+}
+
+// Get returns the value stored under key
+func (s *Scratchpad) Get(key any) (any, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Set stores value under key, which must be comparable
+func (s *Scratchpad) Set(key, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.values == nil {
+		s.values = make(map[any]any)
+	}
+	s.values[key] = value
+}
@@ -0,0 +1,84 @@
+package fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// MachineSnapshot is the serializable runtime state of a Machine.
+// Rules and callbacks are defined in code and are not included.
+type MachineSnapshot struct {
+	State   State          `json:"state"`
+	History []HistoryEntry `json:"history,omitempty"`
+
+	HistoryEnabled bool          `json:"history_enabled,omitempty"`
+	RecordFailures bool          `json:"record_failures,omitempty"`
+	HistoryLimit   int           `json:"history_limit,omitempty"`
+	Sequential     bool          `json:"sequential,omitempty"`
+	GuardTimeout   time.Duration `json:"guard_timeout,omitempty"`
+}
+
+// Snapshot captures the Subject's current state, the history and the
+// Machine's settings.
+func (m *Machine) Snapshot() MachineSnapshot {
+	defer m.lock()()
+
+	return MachineSnapshot{
+		State:          m.Subject.CurrentState(),
+		History:        append([]HistoryEntry(nil), m.history.entries...),
+		HistoryEnabled: m.history.enabled,
+		RecordFailures: m.history.failures,
+		HistoryLimit:   m.history.limit,
+		Sequential:     m.options.sequential,
+		GuardTimeout:   m.options.timeout,
+	}
+}
+
+// Restore reapplies a snapshot, setting the Subject's state directly
+// without running any guards or callbacks.
+func (m *Machine) Restore(s MachineSnapshot) {
+	defer m.lock()()
+
+	m.Subject.SetState(s.State)
+	m.history = history{
+		enabled:  s.HistoryEnabled,
+		failures: s.RecordFailures,
+		limit:    s.HistoryLimit,
+		entries:  append([]HistoryEntry(nil), s.History...),
+	}
+	m.options.sequential = s.Sequential
+	m.options.timeout = s.GuardTimeout
+}
+
+type historyEntryJSON struct {
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Time   time.Time `json:"time"`
+	Err    string    `json:"error,omitempty"`
+	Reset  bool      `json:"reset,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// MarshalJSON encodes the entry with Err as its message
+func (e HistoryEntry) MarshalJSON() ([]byte, error) {
+	j := historyEntryJSON{From: e.From, To: e.To, Time: e.Time, Reset: e.Reset, Reason: e.Reason}
+	if e.Err != nil {
+		j.Err = e.Err.Error()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes an entry; Err only retains the original message.
+func (e *HistoryEntry) UnmarshalJSON(data []byte) error {
+	var j historyEntryJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*e = HistoryEntry{From: j.From, To: j.To, Time: j.Time, Reset: j.Reset, Reason: j.Reason}
+	if j.Err != "" {
+		e.Err = errors.New(j.Err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package fsm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSnapshotKeepsReason(t *testing.T) {
+	r := CreateRuleSet(T{0, 1})
+	m := New(&r, &thing{})
+	m.EnableHistory()
+	if err := m.TransitionReason(1, "approved by ops"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s MachineSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.History) != 1 || s.History[0].Reason != "approved by ops" {
+		t.Fatalf("history after a round trip = %+v", s.History)
+	}
+}
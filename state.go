@@ -0,0 +1,160 @@
+package fsm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var stateNames = struct {
+	sync.RWMutex
+	m map[State]string
+}{m: make(map[State]string)}
+
+// RegisterStateName associates a human readable name with the state.
+// It is safe for concurrent use and is typically called during init.
+func RegisterStateName(s State, name string) {
+	stateNames.Lock()
+	defer stateNames.Unlock()
+
+	stateNames.m[s] = name
+}
+
+// String returns the registered name of the state, or State(n) when unnamed
+func (s State) String() string {
+	stateNames.RLock()
+	name, ok := stateNames.m[s]
+	stateNames.RUnlock()
+
+	if ok {
+		return name
+	}
+	if s == AnyState {
+		return "AnyState"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ParseState returns the state registered under name. Unregistered states
+// may be given in their String form, State(n), or as a bare integer.
+func ParseState(name string) (State, error) {
+	stateNames.RLock()
+	for s, n := range stateNames.m {
+		if n == name {
+			stateNames.RUnlock()
+			return s, nil
+		}
+	}
+	stateNames.RUnlock()
+
+	if name == AnyState.String() {
+		return AnyState, nil
+	}
+
+	num := strings.TrimSuffix(strings.TrimPrefix(name, "State("), ")")
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, fmt.Errorf("unknown state %q", name)
+	}
+	return State(n), nil
+}
+
+// SafeState is a Stater holding nothing but its state, read and written
+// atomically so it is safe for concurrent use.
+type SafeState struct {
+	state atomic.Int64
+}
+
+// NewSafeState returns a SafeState in the initial state
+func NewSafeState(initial State) *SafeState {
+	s := &SafeState{}
+	s.SetState(initial)
+	return s
+}
+
+// CurrentState returns the current state
+func (s *SafeState) CurrentState() State { return State(s.state.Load()) }
+
+// SetState sets the current state
+func (s *SafeState) SetState(state State) { s.state.Store(int64(state)) }
+
+// StaterFunc adapts a getter and a setter, such as closures over a field
+// of a larger struct, into a Stater. It is as safe for concurrent use as
+// get and set are.
+func StaterFunc(get func() State, set func(State)) Stater {
+	return funcStater{get: get, set: set}
+}
+
+type funcStater struct {
+	get func() State
+	set func(State)
+}
+
+func (s funcStater) CurrentState() State { return s.get() }
+
+func (s funcStater) SetState(state State) { s.set(state) }
+
+// StateRegistry allocates unique State values along with their names, as
+// in
+//
+//	var reg fsm.StateRegistry
+//	var Pending = reg.New("Pending")
+//
+// Names are registered as by RegisterStateName, so errors, ParseState and
+// ToDOT use them. The zero value is ready to use and allocates from 0.
+type StateRegistry struct {
+	mu     sync.Mutex
+	next   State
+	states []State
+	byName map[string]State
+}
+
+// New allocates the next unused State and names it. States already
+// named with RegisterStateName are skipped. New panics if the registry
+// already has a state of that name.
+func (r *StateRegistry) New(name string) State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("fsm: state %q registered twice", name))
+	}
+
+	stateNames.Lock()
+	for {
+		if _, taken := stateNames.m[r.next]; !taken && r.next != AnyState {
+			break
+		}
+		r.next++
+	}
+	s := r.next
+	stateNames.m[s] = name
+	stateNames.Unlock()
+	r.next++
+
+	if r.byName == nil {
+		r.byName = make(map[string]State)
+	}
+	r.byName[name] = s
+	r.states = append(r.states, s)
+	return s
+}
+
+// Lookup returns the state allocated under name
+func (r *StateRegistry) Lookup(name string) (State, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.byName[name]
+	return s, ok
+}
+
+// States returns the allocated states in allocation order
+func (r *StateRegistry) States() []State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]State(nil), r.states...)
+}
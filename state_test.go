@@ -0,0 +1,31 @@
+package fsm
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSafeStateConcurrent(t *testing.T) {
+	s := NewSafeState(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.SetState(State(i))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if st := s.CurrentState(); st < 0 || st >= 8 {
+					t.Errorf("CurrentState() = %v, never set", st)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,37 @@
+package fsm
+
+// Stats are counters accumulated over a Machine's lifetime
+type Stats struct {
+	Succeeded int // Succeeded is the number of successful transitions
+	Failed    int // Failed is the number of failed transition attempts
+
+	// Edges counts the successful transitions along each edge
+	Edges map[T]int
+}
+
+func (s *Stats) record(from, to State, err error) {
+	if err != nil {
+		s.Failed++
+		return
+	}
+
+	s.Succeeded++
+	if s.Edges == nil {
+		s.Edges = make(map[T]int)
+	}
+	s.Edges[T{from, to}]++
+}
+
+// Stats returns a copy of the Machine's transition counters
+func (m *Machine) Stats() Stats {
+	defer m.lock()()
+
+	stats := Stats{Succeeded: m.stats.Succeeded, Failed: m.stats.Failed}
+	if m.stats.Edges != nil {
+		stats.Edges = make(map[T]int, len(m.stats.Edges))
+		for t, n := range m.stats.Edges {
+			stats.Edges[t] = n
+		}
+	}
+	return stats
+}
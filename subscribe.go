@@ -0,0 +1,95 @@
+package fsm
+
+import (
+	"sync"
+	"time"
+)
+
+// TransitionEvent is sent to subscribers for every successful transition
+type TransitionEvent struct {
+	From, To State
+	Time     time.Time
+}
+
+// SubscribePolicy decides what happens when a subscriber's buffer is full
+type SubscribePolicy int
+
+const (
+	// DropEvents discards events a subscriber has no room for
+	DropEvents SubscribePolicy = iota
+
+	// BlockOnFull makes transitions wait until the subscriber has room,
+	// holding the Machine locked meanwhile.
+	BlockOnFull
+)
+
+// defaultSubscribeBuffer is the buffer size of new subscriptions unless
+// set with SetSubscribePolicy
+const defaultSubscribeBuffer = 16
+
+type subscriber struct {
+	ch   chan TransitionEvent
+	done chan struct{}
+}
+
+// SetSubscribePolicy sets the policy and buffer size of subscriptions
+// made from now on. The default is DropEvents with a small buffer.
+func (m *Machine) SetSubscribePolicy(p SubscribePolicy, buffer int) {
+	defer m.lock()()
+
+	m.subscribePolicy = p
+	m.subscribeBuffer = buffer
+	if buffer <= 0 {
+		m.subscribeBuffer = defaultSubscribeBuffer
+	}
+}
+
+// Subscribe returns a channel receiving an event for every successful
+// transition from now on, in order, and a function ending the
+// subscription and closing the channel. Events are sent once the
+// outermost call has completed, as the RuleSet's OnEnter callbacks run,
+// so a path TransitionPathAtomic moves back sends none. Each subscriber
+// has its own buffered channel; see SetSubscribePolicy for when it is
+// full.
+func (m *Machine) Subscribe() (<-chan TransitionEvent, func()) {
+	defer m.lock()()
+
+	buffer := m.subscribeBuffer
+	if buffer <= 0 {
+		buffer = defaultSubscribeBuffer
+	}
+	sub := &subscriber{ch: make(chan TransitionEvent, buffer), done: make(chan struct{})}
+	block := m.subscribePolicy == BlockOnFull
+	if m.subscribers == nil {
+		m.subscribers = make(map[*subscriber]bool)
+	}
+	m.subscribers[sub] = block
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			close(sub.done) // releases a transition blocked sending to sub
+			defer m.lock()()
+
+			delete(m.subscribers, sub)
+			close(sub.ch)
+		})
+	}
+}
+
+// publish sends e to every subscriber; m.mu must be held.
+func (m *Machine) publish(e TransitionEvent) {
+	for sub, block := range m.subscribers {
+		if block {
+			select {
+			case sub.ch <- e:
+			case <-sub.done:
+			}
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
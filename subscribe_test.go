@@ -0,0 +1,29 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubscribeSkipsRolledBackPath(t *testing.T) {
+	r := CreateRuleSet(T{0, 1}, T{1, 2})
+	r.AddRuleE(T{1, 2}, func(Stater, State) error { return errors.New("closed") })
+	m := New(&r, &thing{})
+	events, unsubscribe := m.Subscribe()
+
+	if err := m.TransitionPathAtomic(1, 2); err == nil {
+		t.Fatal("expected the path to fail")
+	}
+	if err := m.Transition(1); err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe()
+
+	var got []TransitionEvent
+	for e := range events {
+		got = append(got, e)
+	}
+	if len(got) != 1 || got[0].From != 0 || got[0].To != 1 {
+		t.Fatalf("events = %+v, want only the committed 0 -> 1", got)
+	}
+}
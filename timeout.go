@@ -0,0 +1,75 @@
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// stateTimeout is the transition taken after staying in a state too long
+type stateTimeout struct {
+	d    time.Duration
+	goal State
+}
+
+// SetStateTimeout makes the Machine move the subject from s to onTimeout
+// once it has stayed in s for d. Guards apply as for any transition and
+// the outcome is reported only to observers and the history.
+//
+// Entering s through the Machine starts a timer, and leaving s through
+// the Machine stops it, so at most one timer is pending per Machine and
+// no goroutine runs until it elapses; the expiry then runs in its own
+// goroutine. A pending timer keeps the Machine alive until it elapses.
+// A subject that was moved out of s by other means is left alone. d <= 0
+// removes the timeout and stops its pending timer.
+func (m *Machine) SetStateTimeout(s State, d time.Duration, onTimeout State) {
+	defer m.lock()()
+
+	if d <= 0 {
+		delete(m.timeouts, s)
+		if m.timerState == s {
+			m.arm(AnyState)
+		}
+		return
+	}
+	if m.timeouts == nil {
+		m.timeouts = make(map[State]stateTimeout)
+	}
+	m.timeouts[s] = stateTimeout{d: d, goal: onTimeout}
+}
+
+// arm stops any pending state timer and starts the timer of s, if any;
+// m.mu must be held.
+func (m *Machine) arm(s State) {
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	m.timerGen++
+	m.timerState = AnyState
+
+	timeout, ok := m.timeouts[s]
+	if !ok {
+		return
+	}
+	gen := m.timerGen
+	m.timerState = s
+	m.timer = time.AfterFunc(timeout.d, func() {
+		m.expire(gen, s, timeout.goal)
+	})
+}
+
+// expire performs the timeout transition of the timer generation gen,
+// unless it was stopped or the subject left s meanwhile.
+func (m *Machine) expire(gen uint64, s, goal State) {
+	if err := m.begin(); err != nil {
+		return
+	}
+	defer m.end()
+
+	if gen != m.timerGen || !m.equal(m.Subject.CurrentState(), s) {
+		return
+	}
+	m.timer = nil
+	m.timerState = AnyState
+	m.transition(context.Background(), goal, nil)
+}
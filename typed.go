@@ -0,0 +1,120 @@
+package fsm
+
+import "context"
+
+// TypedGuard is a Guard receiving the concrete subject type.
+// A subject of any other type is never permitted.
+type TypedGuard[S Stater] func(subject S, goal State) bool
+
+// TypedContextGuard is a ContextGuard receiving the concrete subject type.
+type TypedContextGuard[S Stater] func(ctx context.Context, subject S, goal State) error
+
+// AddTypedRule adds typed Guards for the given Transition
+func AddTypedRule[S Stater](r *RuleSet, t Transition, guards ...TypedGuard[S]) {
+	for _, guard := range guards {
+		g := guard
+		r.AddRule(t, func(subject Stater, goal State) bool {
+			s, ok := subject.(S)
+			return ok && g(s, goal)
+		})
+	}
+}
+
+// AddTypedRuleContext adds typed context-aware Guards for the given Transition
+func AddTypedRuleContext[S Stater](r *RuleSet, t Transition, guards ...TypedContextGuard[S]) {
+	for _, guard := range guards {
+		g := guard
+		r.AddRuleContext(t, func(ctx context.Context, subject Stater, goal State) error {
+			s, ok := subject.(S)
+			if !ok {
+				return ErrInvalidTransition
+			}
+			return g(ctx, s, goal)
+		})
+	}
+}
+
+// TypedMachine is a Machine whose Subject has the concrete type S.
+// All Machine methods, such as TransitionContext, are available on it.
+type TypedMachine[S Stater] struct {
+	*Machine
+}
+
+// NewTyped initializes a typed machine
+func NewTyped[S Stater](rules *RuleSet, subject S) *TypedMachine[S] {
+	return &TypedMachine[S]{Machine: New(rules, subject)}
+}
+
+// TypedSubject returns the machine's Subject as its concrete type
+func (m *TypedMachine[S]) TypedSubject() S {
+	defer m.lock()()
+
+	s, _ := m.Subject.(S)
+	return s
+}
+
+// OnEnter registers a typed callback fired after the subject enters the state
+func (m *TypedMachine[S]) OnEnter(s State, fn func(subject S)) {
+	m.Machine.OnEnter(s, func(subject Stater) {
+		if typed, ok := subject.(S); ok {
+			fn(typed)
+		}
+	})
+}
+
+// OnExit registers a typed callback fired before the subject leaves the state
+func (m *TypedMachine[S]) OnExit(s State, fn func(subject S)) {
+	m.Machine.OnExit(s, func(subject Stater) {
+		if typed, ok := subject.(S); ok {
+			fn(typed)
+		}
+	})
+}
+
+// PayloadGuard is an ArgsGuard receiving a payload of type P, as passed
+// by FireTyped. A transition carrying no payload of type P is never
+// permitted.
+type PayloadGuard[P any] func(subject Stater, goal State, payload P) bool
+
+// AddPayloadRule adds payload Guards for the given Transition
+func AddPayloadRule[P any](r *RuleSet, t Transition, guards ...PayloadGuard[P]) {
+	for _, guard := range guards {
+		g := guard
+		r.AddRuleArgs(t, func(subject Stater, goal State, args any) bool {
+			p, ok := args.(P)
+			return ok && g(subject, goal, p)
+		})
+	}
+}
+
+// AddPayloadEvent defines a named event as AddEvent does, guarded by
+// payload Guards.
+func AddPayloadEvent[P any](r *RuleSet, name string, from, to State, guards ...PayloadGuard[P]) {
+	r.AddEvent(name, from, to)
+	AddPayloadRule(r, T{from, to}, guards...)
+}
+
+// OnEnterPayload registers a callback fired after the subject enters the
+// state by a transition carrying a payload of type P.
+func OnEnterPayload[P any](m *Machine, s State, fn func(subject Stater, payload P)) {
+	m.OnEnterWith(s, func(subject Stater, args any) {
+		if p, ok := args.(P); ok {
+			fn(subject, p)
+		}
+	})
+}
+
+// FireTyped fires the named event as Machine.Fire does, passing payload
+// to the guards and callbacks like the args of TransitionWith.
+func FireTyped[P any](m *Machine, event string, payload P) error {
+	if err := m.begin(); err != nil {
+		return err
+	}
+	defer m.end()
+
+	e, ok := m.Rules.event(m.Subject.CurrentState(), event)
+	if !ok {
+		return ErrNoSuchEvent
+	}
+	return m.transition(context.Background(), e.To, &request{args: payload})
+}
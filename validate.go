@@ -0,0 +1,67 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnreachableState the state can never be entered from the start state
+	ErrUnreachableState = errors.New("unreachable state")
+
+	// ErrDeadEnd the non-terminal state has no outgoing transitions
+	ErrDeadEnd = errors.New("dead end state")
+)
+
+// Validate walks the rule graph from start, ignoring guards, and returns
+// an error for every unreachable state and for every state without
+// outgoing transitions that is not one of the terminals or marked
+// terminal.
+func (r *RuleSet) Validate(start State, terminals ...State) []error {
+	terminal := make(map[State]bool)
+	for s := range r.terminals {
+		terminal[s] = true
+	}
+	for _, s := range terminals {
+		terminal[s] = true
+	}
+
+	reachable := map[State]bool{start: true}
+	queue := []State{start}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		for _, goal := range r.goals(s) {
+			if !reachable[goal] {
+				reachable[goal] = true
+				queue = append(queue, goal)
+			}
+		}
+	}
+
+	states := r.States()
+	if !containsState(states, start) {
+		states = append([]State{start}, states...)
+	}
+
+	var errs []error
+	for _, s := range states {
+		if !reachable[s] {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrUnreachableState, s))
+		}
+		if !terminal[s] && len(r.goals(s)) == 0 {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrDeadEnd, s))
+		}
+	}
+	return errs
+}
+
+func containsState(states []State, s State) bool {
+	for _, candidate := range states {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package fsm
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LoadRuleSetYAML reads a YAML encoded RuleSet from r, in the form
+// written by WriteYAML. As with LoadRuleSet each transition gets the
+// default rule and guards referenced by name must be attached afterwards
+// with AttachGuards; until then their transitions are rejected.
+//
+// Only the block style subset of YAML written by WriteYAML is understood:
+// mappings, sequences, plain and quoted scalars, and comments.
+func LoadRuleSetYAML(r io.Reader) (RuleSet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	lines, err := yamlLines(string(data))
+	if err != nil {
+		return RuleSet{}, err
+	}
+	if len(lines) == 0 {
+		return RuleSet{}, nil
+	}
+
+	doc, next, err := parseYAML(lines, 0, lines[0].indent)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	if next < len(lines) {
+		return RuleSet{}, fmt.Errorf("yaml: line %d: unexpected indentation", lines[next].num)
+	}
+
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return RuleSet{}, fmt.Errorf("yaml: definition must be a mapping")
+	}
+
+	def, err := yamlDefinition(root)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	return def.ruleSet()
+}
+
+// WriteYAML writes the states by registered name, the transitions with
+// the names of their guards, the events, the terminal states and the
+// start state to w as YAML.
+func (r *RuleSet) WriteYAML(w io.Writer) error {
+	def := r.definition()
+
+	var b strings.Builder
+	writeYAMLList(&b, "states", def.States)
+
+	if len(def.Transitions) == 0 {
+		b.WriteString("transitions: []\n")
+	} else {
+		b.WriteString("transitions:\n")
+	}
+	for _, t := range def.Transitions {
+		fmt.Fprintf(&b, "  - origin: %s\n", yamlScalar(t.Origin))
+		fmt.Fprintf(&b, "    exit: %s\n", yamlScalar(t.Exit))
+		if len(t.Guards) > 0 {
+			b.WriteString("    guards:\n")
+			for _, g := range t.Guards {
+				fmt.Fprintf(&b, "      - %s\n", yamlScalar(g))
+			}
+		}
+	}
+
+	if len(def.Events) > 0 {
+		b.WriteString("events:\n")
+	}
+	for _, e := range def.Events {
+		fmt.Fprintf(&b, "  - name: %s\n", yamlScalar(e.Name))
+		fmt.Fprintf(&b, "    from: %s\n", yamlScalar(e.From))
+		fmt.Fprintf(&b, "    to: %s\n", yamlScalar(e.To))
+	}
+
+	writeYAMLList(&b, "terminals", def.Terminals)
+	if def.Start != "" {
+		fmt.Fprintf(&b, "start: %s\n", yamlScalar(def.Start))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeYAMLList(b *strings.Builder, key string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", key)
+	for _, item := range items {
+		fmt.Fprintf(b, "  - %s\n", yamlScalar(item))
+	}
+}
+
+var yamlPlain = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.()-]*$`)
+
+// yamlScalar returns s as a plain scalar when that reads back as the same
+// string in any YAML parser, otherwise double quoted.
+func yamlScalar(s string) string {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null":
+		return strconv.Quote(s)
+	}
+	if yamlPlain.MatchString(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// yamlLine is a significant line of a YAML document
+type yamlLine struct {
+	num    int // num is the 1-based line number
+	indent int
+	text   string
+}
+
+// yamlLines splits a document into its lines, dropping blank lines,
+// comments and document markers.
+func yamlLines(doc string) ([]yamlLine, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(doc, "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || text == "---" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs can't be used for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	return lines, nil
+}
+
+// parseYAML parses the block starting at lines[i] with the given indent,
+// returning a string, []any or map[string]any and the index of the
+// first line after the block.
+func parseYAML(lines []yamlLine, i, indent int) (any, int, error) {
+	text := lines[i].text
+	if yamlItem(text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	if _, _, ok := yamlKey(text); ok {
+		return parseYAMLMapping(lines, i, indent)
+	}
+	v, err := yamlValue(lines[i])
+	return v, i + 1, err
+}
+
+func parseYAMLSequence(lines []yamlLine, i, indent int) (any, int, error) {
+	seq := []any{}
+	for i < len(lines) && lines[i].indent == indent && yamlItem(lines[i].text) {
+		l := lines[i]
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			var item any
+			i++
+			if i < len(lines) && lines[i].indent > indent {
+				var err error
+				if item, i, err = parseYAML(lines, i, lines[i].indent); err != nil {
+					return nil, i, err
+				}
+			}
+			seq = append(seq, item)
+			continue
+		}
+
+		// the item continues as a block indented up to its content
+		offset := len(l.text) - len(rest)
+		lines[i] = yamlLine{num: l.num, indent: indent + offset, text: rest}
+
+		item, next, err := parseYAML(lines, i, indent+offset)
+		if err != nil {
+			return nil, next, err
+		}
+		seq = append(seq, item)
+		i = next
+	}
+	return seq, i, nil
+}
+
+func parseYAMLMapping(lines []yamlLine, i, indent int) (any, int, error) {
+	m := map[string]any{}
+	for i < len(lines) && lines[i].indent == indent {
+		l := lines[i]
+		key, value, ok := yamlKey(l.text)
+		if !ok {
+			return nil, i, fmt.Errorf("yaml: line %d: expected a key", l.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, i, fmt.Errorf("yaml: line %d: duplicate key %q", l.num, key)
+		}
+		i++
+
+		if value != "" {
+			v, err := yamlValue(yamlLine{num: l.num, text: value})
+			if err != nil {
+				return nil, i, err
+			}
+			m[key] = v
+			continue
+		}
+
+		m[key] = nil
+		if i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && yamlItem(lines[i].text)) {
+			v, next, err := parseYAML(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			m[key] = v
+			i = next
+		}
+	}
+	return m, i, nil
+}
+
+func yamlItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// yamlKey splits a "key: value" line; value is empty when the key
+// introduces a nested block.
+func yamlKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		return "", "", false
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return text[:i], strings.TrimSpace(text[i+2:]), true
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return text[:len(text)-1], "", true
+	}
+	return "", "", false
+}
+
+// yamlValue decodes a scalar or an empty flow collection
+func yamlValue(l yamlLine) (any, error) {
+	text := l.text
+	switch {
+	case strings.HasPrefix(text, `"`):
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid quoted string", l.num)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("yaml: line %d: invalid quoted string", l.num)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case text == "[]":
+		return []any{}, nil
+	case text == "{}":
+		return map[string]any{}, nil
+	}
+
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	return text, nil
+}
+
+// yamlDefinition converts a parsed document into a definition
+func yamlDefinition(root map[string]any) (ruleSetJSON, error) {
+	var def ruleSetJSON
+	var err error
+
+	if def.States, err = yamlStrings(root["states"], "states"); err != nil {
+		return def, err
+	}
+	if def.Terminals, err = yamlStrings(root["terminals"], "terminals"); err != nil {
+		return def, err
+	}
+	if def.Start, err = yamlString(root, "start"); err != nil {
+		return def, err
+	}
+
+	transitions, err := yamlMappings(root["transitions"], "transitions")
+	if err != nil {
+		return def, err
+	}
+	for i, m := range transitions {
+		var rule ruleJSON
+		if rule.Origin, err = yamlRequired(m, "origin", "transition", i); err != nil {
+			return def, err
+		}
+		if rule.Exit, err = yamlRequired(m, "exit", "transition", i); err != nil {
+			return def, err
+		}
+		if rule.Guards, err = yamlStrings(m["guards"], "guards"); err != nil {
+			return def, err
+		}
+		def.Transitions = append(def.Transitions, rule)
+	}
+
+	events, err := yamlMappings(root["events"], "events")
+	if err != nil {
+		return def, err
+	}
+	for i, m := range events {
+		var event eventJSON
+		if event.Name, err = yamlRequired(m, "name", "event", i); err != nil {
+			return def, err
+		}
+		if event.From, err = yamlRequired(m, "from", "event", i); err != nil {
+			return def, err
+		}
+		if event.To, err = yamlRequired(m, "to", "event", i); err != nil {
+			return def, err
+		}
+		def.Events = append(def.Events, event)
+	}
+
+	return def, nil
+}
+
+func yamlString(m map[string]any, key string) (string, error) {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("yaml: %s must be a string", key)
+	}
+	return s, nil
+}
+
+// yamlRequired is like yamlString but fails when the key is missing from
+// the i'th item of a list.
+func yamlRequired(m map[string]any, key, item string, i int) (string, error) {
+	s, err := yamlString(m, key)
+	if err == nil && s == "" {
+		err = fmt.Errorf("yaml: %s %d: missing %s", item, i+1, key)
+	}
+	return s, err
+}
+
+func yamlStrings(v any, field string) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	seq, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("yaml: %s must be a list", field)
+	}
+
+	var items []string
+	for _, item := range seq {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("yaml: %s must be a list of strings", field)
+		}
+		items = append(items, s)
+	}
+	return items, nil
+}
+
+func yamlMappings(v any, field string) ([]map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	seq, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("yaml: %s must be a list", field)
+	}
+
+	var items []map[string]any
+	for _, item := range seq {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("yaml: %s must be a list of mappings", field)
+		}
+		items = append(items, m)
+	}
+	return items, nil
+}
@@ -0,0 +1,106 @@
+package fsm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterStateName(600, "YAMLDraft")
+	RegisterStateName(601, "on hold: legal")
+	RegisterStateName(602, "YAMLDone")
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	approved := func(Stater, State) bool { return true }
+	signed := func(Stater, State) bool { return false }
+
+	r := CreateRuleSet(T{601, 602}, T{AnyState, 600})
+	r.AddNamedRule(T{601, 602}, "approved", approved)
+	r.AddNamedRule(T{601, 602}, "signed: twice", signed)
+	r.AddEvent("hold #1", 600, 601)
+	r.MarkTerminal(602)
+	r.SetStart(600)
+
+	var b strings.Builder
+	if err := r.WriteYAML(&b); err != nil {
+		t.Fatal(err)
+	}
+	var reg GuardRegistry
+	reg.Register("approved", approved)
+	reg.Register("signed: twice", signed)
+	loaded, err := reg.LoadRuleSetYAML(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("%v reading\n%s", err, b.String())
+	}
+
+	if diff := r.Diff(loaded); diff != "" {
+		t.Fatalf("round trip of\n%s\ndiffers:\n%s", b.String(), diff)
+	}
+	want, _ := json.Marshal(r)
+	got, _ := json.Marshal(loaded)
+	if string(got) != string(want) {
+		t.Fatalf("round trip of\n%s\ngave %s, want %s", b.String(), got, want)
+	}
+}
+
+func TestWriteYAMLSkipsUnnamedGuards(t *testing.T) {
+	r := CreateRuleSet(T{600, 601})
+	r.AddRule(T{600, 601}, func(Stater, State) bool { return true })
+	r.AddConditions(T{600, 601}, Condition(nil))
+
+	var b strings.Builder
+	if err := r.WriteYAML(&b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "guards") {
+		t.Fatalf("unnamed guards were written:\n%s", b.String())
+	}
+}
+
+func TestLoadRuleSetYAML(t *testing.T) {
+	doc := `# a comment line
+start: YAMLDraft # a trailing comment
+transitions:
+  - origin: YAMLDraft
+    exit: 'on hold: legal'
+    guards: []
+  -
+    origin: "on hold: legal"
+    exit: YAMLDone
+`
+	r, err := LoadRuleSetYAML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Start() != 600 {
+		t.Fatalf("Start() = %v, want YAMLDraft", r.Start())
+	}
+	if !r.Permitted(&thing{600}, 601) || !r.Permitted(&thing{601}, 602) {
+		t.Fatal("transitions of the document aren't permitted")
+	}
+}
+
+func TestLoadRuleSetYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, want string
+	}{
+		{"tab", "transitions:\n\t- origin: YAMLDraft\n", "tabs"},
+		{"duplicate key", "start: YAMLDraft\nstart: YAMLDone\n", "duplicate key"},
+		{"indentation", "transitions:\n  - origin: YAMLDraft\n      exit: YAMLDone\n", "indentation"},
+		{"missing origin", "transitions:\n  - exit: YAMLDone\n", "missing origin"},
+		{"missing exit", "transitions:\n  - origin: YAMLDraft\n", "missing exit"},
+		{"missing event name", "events:\n  - from: YAMLDraft\n    to: YAMLDone\n", "missing name"},
+		{"not a mapping", "- YAMLDraft\n", "must be a mapping"},
+		{"bad quote", "start: \"YAMLDraft\n", "invalid quoted string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadRuleSetYAML(strings.NewReader(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}